@@ -0,0 +1,577 @@
+package admin
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg.re/essentialkaos/ek.v3/fsutil"
+	"pkg.re/essentialkaos/ek.v3/knf"
+	"pkg.re/essentialkaos/ek.v3/log"
+	"pkg.re/essentialkaos/ek.v3/path"
+
+	"github.com/essentialkaos/mockka/rules"
+	"github.com/essentialkaos/mockka/server"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+const (
+	HTTP_READ_TIMEOUT     = "http:read-timeout"
+	HTTP_WRITE_TIMEOUT    = "http:write-timeout"
+	ADMIN_IP              = "admin:ip"
+	ADMIN_PORT            = "admin:port"
+	ACCESS_MOCK_PERMS     = "access:mock-perms"
+	ACCESS_MOCK_DIR_PERMS = "access:mock-dir-perms"
+)
+
+const (
+	STORAGE_MEMORY = "memory"
+	STORAGE_DISK   = "disk"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// ErrorResponse is response with error description
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ReloadResponse is response with rules reloading result
+type ReloadResponse struct {
+	OK bool `json:"ok"`
+}
+
+// VerifyResponse is response with requests verification result
+type VerifyResponse struct {
+	OK       bool `json:"ok"`
+	Count    int  `json:"count"`
+	Expected int  `json:"expected"`
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Handler is HTTP handler for admin API
+type Handler struct {
+	observer *rules.Observer
+	journal  *server.Journal
+	mux      *http.ServeMux
+
+	// saveMock is function used for saving mock files
+	saveMock func(mockFile string, content []byte) error
+
+	// rulesLock serializes rules modification (conflicts checking and
+	// mock files writing)
+	rulesLock sync.Mutex
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Start starts admin HTTP server
+func Start(obs *rules.Observer, jrn *server.Journal) error {
+	if obs == nil {
+		return errors.New("Observer is not created")
+	}
+
+	ip, port := knf.GetS(ADMIN_IP, "127.0.0.1"), knf.GetS(ADMIN_PORT)
+
+	if port == "" {
+		return errors.New("Admin port is not defined")
+	}
+
+	server := &http.Server{
+		Addr:         ip + ":" + port,
+		Handler:      NewHandler(obs, jrn),
+		ReadTimeout:  time.Duration(knf.GetI(HTTP_READ_TIMEOUT, 10)) * time.Second,
+		WriteTimeout: time.Duration(knf.GetI(HTTP_WRITE_TIMEOUT, 60)) * time.Second,
+	}
+
+	log.Aux("Mockka admin HTTP server started on %s:%s\n", ip, port)
+
+	return server.ListenAndServe()
+}
+
+// NewHandler create new admin API handler for given observer and journal
+// (journal can be nil)
+func NewHandler(obs *rules.Observer, jrn *server.Journal) *Handler {
+	h := &Handler{
+		observer: obs,
+		journal:  jrn,
+		mux:      http.NewServeMux(),
+		saveMock: writeMock,
+	}
+
+	h.mux.HandleFunc("/services", h.servicesHandler)
+	h.mux.HandleFunc("/services/", h.serviceHandler)
+	h.mux.HandleFunc("/rules/", h.ruleHandler)
+	h.mux.HandleFunc("/reload", h.reloadHandler)
+	h.mux.HandleFunc("/scenarios", h.scenariosHandler)
+	h.mux.HandleFunc("/scenarios/", h.scenariosHandler)
+	h.mux.HandleFunc("/journal", h.journalHandler)
+	h.mux.HandleFunc("/journal/verify", h.verifyHandler)
+
+	return h
+}
+
+// ServeHTTP is handler for all admin API requests
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// servicesHandler return list of services
+func (h *Handler) servicesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Method %s is not allowed", r.Method)
+		return
+	}
+
+	services := h.observer.GetServices()
+
+	if services == nil {
+		services = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, services)
+}
+
+// serviceHandler return list of service rules
+func (h *Handler) serviceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Method %s is not allowed", r.Method)
+		return
+	}
+
+	service := strings.Trim(strings.TrimPrefix(r.URL.Path, "/services/"), "/")
+
+	if service == "" || strings.Contains(service, "/") {
+		writeError(w, http.StatusBadRequest, "Service name is not valid")
+		return
+	}
+
+	names := h.observer.GetServiceRulesNames(service)
+
+	if names == nil {
+		names = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, names)
+}
+
+// ruleHandler process requests for rule info, creation and deletion
+func (h *Handler) ruleHandler(w http.ResponseWriter, r *http.Request) {
+	service, name, err := parseRuleName(r.URL.Path)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		h.getRule(w, r, service, name)
+	case "PUT":
+		h.putRule(w, r, service, name)
+	case "DELETE":
+		h.deleteRule(w, r, service, name)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method %s is not allowed", r.Method)
+	}
+}
+
+// reloadHandler force rules reloading
+func (h *Handler) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method %s is not allowed", r.Method)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &ReloadResponse{h.observer.Load()})
+}
+
+// scenariosHandler return, set or reset scenarios states
+func (h *Handler) scenariosHandler(w http.ResponseWriter, r *http.Request) {
+	scenario := strings.Trim(strings.TrimPrefix(r.URL.Path, "/scenarios"), "/")
+
+	switch {
+	case r.Method == "GET" && scenario == "":
+		writeJSON(w, http.StatusOK, h.observer.GetScenarios())
+
+	case r.Method == "PUT" && scenario != "":
+		state := r.URL.Query().Get("state")
+
+		if state == "" {
+			writeError(w, http.StatusBadRequest, "Scenario state is not defined")
+			return
+		}
+
+		h.observer.SetScenarioState(scenario, state)
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == "DELETE" && scenario == "":
+		h.observer.ResetScenarios()
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == "DELETE":
+		h.observer.ResetScenarios(scenario)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method %s is not allowed", r.Method)
+	}
+}
+
+// journalHandler return journal records which fit filter or clean journal
+func (h *Handler) journalHandler(w http.ResponseWriter, r *http.Request) {
+	if h.journal == nil {
+		writeError(w, http.StatusNotFound, "Journal is disabled")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		filter, err := parseJournalFilter(r)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+
+		records := h.journal.Find(filter)
+
+		if records == nil {
+			records = []*server.LogRecord{}
+		}
+
+		writeJSON(w, http.StatusOK, records)
+
+	case "DELETE":
+		h.journal.Reset()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method %s is not allowed", r.Method)
+	}
+}
+
+// verifyHandler check number of requests which fit filter, if count is
+// not defined it checks that there is at least one request
+func (h *Handler) verifyHandler(w http.ResponseWriter, r *http.Request) {
+	if h.journal == nil {
+		writeError(w, http.StatusNotFound, "Journal is disabled")
+		return
+	}
+
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Method %s is not allowed", r.Method)
+		return
+	}
+
+	filter, err := parseJournalFilter(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	result := &VerifyResponse{Count: h.journal.Count(filter), Expected: -1}
+
+	if r.URL.Query().Get("count") != "" {
+		result.Expected, err = strconv.Atoi(r.URL.Query().Get("count"))
+
+		if err != nil || result.Expected < 0 {
+			writeError(w, http.StatusBadRequest, "Count must be non-negative number")
+			return
+		}
+
+		result.OK = result.Count == result.Expected
+	} else {
+		result.OK = result.Count != 0
+	}
+
+	if result.OK {
+		writeJSON(w, http.StatusOK, result)
+	} else {
+		writeJSON(w, http.StatusExpectationFailed, result)
+	}
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// getRule return rule info
+func (h *Handler) getRule(w http.ResponseWriter, r *http.Request, service, name string) {
+	rule := h.observer.GetRuleByName(service, name)
+
+	if rule == nil {
+		writeError(w, http.StatusNotFound, "Rule %s is not found", path.Join(service, name))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// putRule create or update rule, request body must contain mock file data
+func (h *Handler) putRule(w http.ResponseWriter, r *http.Request, service, name string) {
+	storage := r.URL.Query().Get("storage")
+
+	if storage == "" {
+		storage = STORAGE_MEMORY
+	}
+
+	if storage != STORAGE_MEMORY && storage != STORAGE_DISK {
+		writeError(w, http.StatusBadRequest, "Unknown storage %s", storage)
+		return
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Can't read request body: %v", err)
+		return
+	}
+
+	dir, mock := path.Dir(name), path.Base(name)
+
+	if dir == "." {
+		dir = ""
+	}
+
+	rule, err := rules.ParseContent(content, h.observer.RuleDir(), service, dir, mock)
+
+	if err == nil && rule.Request.URL == "" {
+		err = errors.New("Section REQUEST is empty")
+	}
+
+	if err == nil {
+		err = rule.LoadFiles()
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	h.rulesLock.Lock()
+	defer h.rulesLock.Unlock()
+
+	code := http.StatusCreated
+
+	if h.observer.GetRuleByName(service, name) != nil {
+		code = http.StatusOK
+	}
+
+	if storage == STORAGE_MEMORY {
+		err = h.observer.AddRule(rule)
+
+		if err != nil {
+			writeError(w, http.StatusConflict, "%v", err)
+			return
+		}
+
+		writeJSON(w, code, rule)
+
+		return
+	}
+
+	err = h.observer.CheckRule(rule)
+
+	if err != nil {
+		writeError(w, http.StatusConflict, "%v", err)
+		return
+	}
+
+	// Previous content is used for restoring mock file if rule can't be
+	// loaded from it
+	mockFile := rule.Path
+	prevContent, prevErr := ioutil.ReadFile(mockFile)
+
+	err = h.saveMock(mockFile, content)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+
+	// Rule from mock file can be hidden by in memory rule with same name
+	current := h.observer.GetRuleByName(service, name)
+
+	if current != nil && current.InMemory {
+		h.observer.RemoveRule(service, name)
+	}
+
+	h.observer.ReloadFiles(mockFile)
+
+	rule = h.observer.GetRuleByName(service, name)
+
+	if rule != nil && rule != current {
+		writeJSON(w, code, rule)
+		return
+	}
+
+	if prevErr == nil {
+		err = h.saveMock(mockFile, prevContent)
+	} else {
+		err = os.Remove(mockFile)
+	}
+
+	if err != nil {
+		log.Error("Can't restore mock file %s: %v", path.Join(service, name), err)
+	}
+
+	h.observer.ReloadFiles(mockFile)
+
+	if current != nil && current.InMemory {
+		h.observer.AddRule(current)
+	}
+
+	writeError(w, http.StatusInternalServerError, "Rule %s can't be loaded from mock file, changes reverted", path.Join(service, name))
+}
+
+// deleteRule unload in memory rule or remove mock file
+func (h *Handler) deleteRule(w http.ResponseWriter, r *http.Request, service, name string) {
+	h.rulesLock.Lock()
+	defer h.rulesLock.Unlock()
+
+	rule := h.observer.GetRuleByName(service, name)
+
+	if rule == nil {
+		writeError(w, http.StatusNotFound, "Rule %s is not found", path.Join(service, name))
+		return
+	}
+
+	if rule.InMemory {
+		h.observer.RemoveRule(service, name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	err := os.Remove(rule.Path)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Can't remove file %s: %v", rule.Path, err)
+		return
+	}
+
+	h.observer.ReloadFiles(rule.Path)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// parseRuleName parse url path and return service name and rule full name
+func parseRuleName(urlPath string) (string, string, error) {
+	fullName := strings.Trim(strings.TrimPrefix(urlPath, "/rules/"), "/")
+	index := strings.Index(fullName, "/")
+
+	if index == -1 {
+		return "", "", errors.New("You must define rule name as <service-id>/<mock-name>")
+	}
+
+	service, name := fullName[:index], fullName[index+1:]
+
+	for _, part := range strings.Split(fullName, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", "", fmt.Errorf("Rule name %s is not valid", fullName)
+		}
+	}
+
+	return service, strings.TrimSuffix(name, ".mock"), nil
+}
+
+// parseJournalFilter create journal filter from request query
+func parseJournalFilter(r *http.Request) (*server.JournalFilter, error) {
+	var err error
+
+	query := r.URL.Query()
+
+	filter := &server.JournalFilter{
+		Rule:   strings.TrimSuffix(query.Get("rule"), ".mock"),
+		Method: query.Get("method"),
+		URL:    query.Get("url"),
+	}
+
+	header := query.Get("header")
+
+	if header != "" {
+		index := strings.Index(header, ":")
+
+		if index == -1 {
+			filter.Header = header
+		} else {
+			filter.Header = strings.TrimSpace(header[:index])
+			filter.HeaderValue = strings.TrimSpace(header[index+1:])
+		}
+	}
+
+	if query.Get("since") != "" {
+		filter.Since, err = time.Parse(time.RFC3339, query.Get("since"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Can't parse since date: %v", err)
+		}
+	}
+
+	if query.Get("until") != "" {
+		filter.Until, err = time.Parse(time.RFC3339, query.Get("until"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Can't parse until date: %v", err)
+		}
+	}
+
+	return filter, nil
+}
+
+// writeMock save mock file data to file
+func writeMock(mockFile string, content []byte) error {
+	mockDir := path.Dir(mockFile)
+
+	if !fsutil.IsExist(mockDir) {
+		err := os.MkdirAll(mockDir, 0755)
+
+		if err != nil {
+			return fmt.Errorf("Can't create directory %s", mockDir)
+		}
+
+		os.Chmod(mockDir, knf.GetM(ACCESS_MOCK_DIR_PERMS, 0775))
+	}
+
+	err := ioutil.WriteFile(mockFile, content, 0644)
+
+	if err != nil {
+		return fmt.Errorf("Can't save file %s", mockFile)
+	}
+
+	os.Chmod(mockFile, knf.GetM(ACCESS_MOCK_PERMS, 0664))
+
+	return nil
+}
+
+// writeJSON encode data to JSON and write it as response
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeError write response with error description
+func writeError(w http.ResponseWriter, code int, format string, a ...interface{}) {
+	writeJSON(w, code, &ErrorResponse{fmt.Sprintf(format, a...)})
+}
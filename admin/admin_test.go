@@ -0,0 +1,208 @@
+package admin
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/essentialkaos/mockka/rules"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func Test(t *testing.T) { TestingT(t) }
+
+type AdminSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&AdminSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+const testMock = "@REQUEST\nGET /test\n\n@AUTH\nbob:secret\n\n@RESPONSE\nTest\n"
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *AdminSuite) TestEmptyLists(c *C) {
+	h := NewHandler(rules.NewObserver(c.MkDir()), nil)
+
+	code, body := sendRequest(h, "GET", "/services", "")
+
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(body, Equals, "[]\n")
+
+	code, body = sendRequest(h, "GET", "/services/unknown", "")
+
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(body, Equals, "[]\n")
+
+	code, _ = sendRequest(h, "GET", "/journal", "")
+
+	c.Assert(code, Equals, http.StatusNotFound)
+}
+
+func (s *AdminSuite) TestMemoryStorage(c *C) {
+	ruleDir := c.MkDir()
+	h := NewHandler(rules.NewObserver(ruleDir), nil)
+
+	code, _ := sendRequest(h, "PUT", "/rules/service/test", testMock)
+
+	c.Assert(code, Equals, http.StatusCreated)
+	c.Assert(fileExist(ruleDir+"/service/test.mock"), Equals, false)
+
+	code, body := sendRequest(h, "GET", "/rules/service/test", "")
+
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(body, Matches, `(?s).*"InMemory":true.*`)
+	c.Assert(body, Matches, `(?s).*"User":"bob".*`)
+	c.Assert(strings.Contains(body, "secret"), Equals, false)
+
+	code, _ = sendRequest(h, "PUT", "/rules/service/test", strings.Replace(testMock, "Test", "Test2", -1))
+
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(h.observer.GetRuleByName("service", "test").Responses[rules.DEFAULT].Body(), Equals, "Test2\n")
+
+	code, body = sendRequest(h, "GET", "/services", "")
+
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(body, Equals, "[\"service\"]\n")
+
+	code, _ = sendRequest(h, "PUT", "/rules/service/conflict", testMock)
+
+	c.Assert(code, Equals, http.StatusConflict)
+
+	code, _ = sendRequest(h, "DELETE", "/rules/service/test", "")
+
+	c.Assert(code, Equals, http.StatusNoContent)
+	c.Assert(h.observer.GetRuleByName("service", "test"), IsNil)
+
+	code, _ = sendRequest(h, "DELETE", "/rules/service/test", "")
+
+	c.Assert(code, Equals, http.StatusNotFound)
+}
+
+func (s *AdminSuite) TestDiskStorage(c *C) {
+	ruleDir := c.MkDir()
+	h := NewHandler(rules.NewObserver(ruleDir), nil)
+
+	code, _ := sendRequest(h, "PUT", "/rules/service/dir/test?storage=disk", testMock)
+
+	c.Assert(code, Equals, http.StatusCreated)
+
+	data, err := ioutil.ReadFile(ruleDir + "/service/dir/test.mock")
+
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, testMock)
+
+	rule := h.observer.GetRuleByName("service", "dir/test")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(rule.InMemory, Equals, false)
+
+	code, _ = sendRequest(h, "PUT", "/rules/service/dir/test?storage=disk", strings.Replace(testMock, "Test", "Test2", -1))
+
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(h.observer.GetRuleByName("service", "dir/test").Responses[rules.DEFAULT].Body(), Equals, "Test2\n")
+
+	code, _ = sendRequest(h, "PUT", "/rules/service/dir/test?storage=cloud", testMock)
+
+	c.Assert(code, Equals, http.StatusBadRequest)
+
+	code, _ = sendRequest(h, "DELETE", "/rules/service/dir/test", "")
+
+	c.Assert(code, Equals, http.StatusNoContent)
+	c.Assert(fileExist(ruleDir+"/service/dir/test.mock"), Equals, false)
+	c.Assert(h.observer.GetRuleByName("service", "dir/test"), IsNil)
+}
+
+func (s *AdminSuite) TestDiskStorageRollback(c *C) {
+	ruleDir := c.MkDir()
+	h := NewHandler(rules.NewObserver(ruleDir), nil)
+
+	// Mock file is corrupted while saving, so rule can't be loaded from it
+	h.saveMock = func(mockFile string, content []byte) error {
+		if strings.Contains(string(content), "Broken") {
+			content = []byte("@REQUEST\nGET /test\n\n@CODE\nBroken\n")
+		}
+
+		return writeMock(mockFile, content)
+	}
+
+	code, _ := sendRequest(h, "PUT", "/rules/service/test?storage=disk", strings.Replace(testMock, "Test", "Broken", -1))
+
+	c.Assert(code, Equals, http.StatusInternalServerError)
+	c.Assert(fileExist(ruleDir+"/service/test.mock"), Equals, false)
+	c.Assert(h.observer.GetRuleByName("service", "test"), IsNil)
+
+	code, _ = sendRequest(h, "PUT", "/rules/service/test?storage=disk", testMock)
+
+	c.Assert(code, Equals, http.StatusCreated)
+
+	code, _ = sendRequest(h, "PUT", "/rules/service/test?storage=disk", strings.Replace(testMock, "Test", "Broken", -1))
+
+	c.Assert(code, Equals, http.StatusInternalServerError)
+
+	data, err := ioutil.ReadFile(ruleDir + "/service/test.mock")
+
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, testMock)
+	c.Assert(h.observer.GetRuleByName("service", "test").Responses[rules.DEFAULT].Body(), Equals, "Test\n")
+
+	// In memory rule which hides rule from mock file must be restored
+	code, _ = sendRequest(h, "PUT", "/rules/service/test", strings.Replace(testMock, "Test", "Memory", -1))
+
+	c.Assert(code, Equals, http.StatusOK)
+
+	code, _ = sendRequest(h, "PUT", "/rules/service/test?storage=disk", strings.Replace(testMock, "Test", "Broken", -1))
+
+	c.Assert(code, Equals, http.StatusInternalServerError)
+
+	rule := h.observer.GetRuleByName("service", "test")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(rule.InMemory, Equals, true)
+	c.Assert(rule.Responses[rules.DEFAULT].Body(), Equals, "Memory\n")
+}
+
+func (s *AdminSuite) TestRuleName(c *C) {
+	h := NewHandler(rules.NewObserver(c.MkDir()), nil)
+
+	code, _ := sendRequest(h, "GET", "/rules/service", "")
+
+	c.Assert(code, Equals, http.StatusBadRequest)
+
+	code, _ = sendRequest(h, "GET", "/rules/service/unknown", "")
+
+	c.Assert(code, Equals, http.StatusNotFound)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// sendRequest send request to handler and return response code and body
+func sendRequest(h http.Handler, method, url, body string) (int, string) {
+	r := httptest.NewRequest(method, url, strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	return w.Code, w.Body.String()
+}
+
+// fileExist return true if file exists
+func fileExist(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
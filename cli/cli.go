@@ -15,12 +15,14 @@ import (
 	"pkg.re/essentialkaos/ek.v3/arg"
 	"pkg.re/essentialkaos/ek.v3/fmtc"
 	"pkg.re/essentialkaos/ek.v3/fsutil"
+	"pkg.re/essentialkaos/ek.v3/httputil"
 	"pkg.re/essentialkaos/ek.v3/knf"
 	"pkg.re/essentialkaos/ek.v3/log"
 	"pkg.re/essentialkaos/ek.v3/signal"
 	"pkg.re/essentialkaos/ek.v3/system"
 	"pkg.re/essentialkaos/ek.v3/usage"
 
+	"github.com/essentialkaos/mockka/admin"
 	"github.com/essentialkaos/mockka/generator"
 	"github.com/essentialkaos/mockka/listing"
 	"github.com/essentialkaos/mockka/rules"
@@ -32,7 +34,7 @@ import (
 
 const (
 	APP  = "Mockka"
-	VER  = "1.7.4"
+	VER  = "1.8.0"
 	DESC = "Utility for mockking HTTP API's"
 )
 
@@ -41,6 +43,8 @@ const (
 	ARG_PORT     = "p:port"
 	ARG_DAEMON   = "d:daemon"
 	ARG_NO_COLOR = "nc:no-color"
+	ARG_UPSTREAM = "U:upstream"
+	ARG_FORMAT   = "f:format"
 	ARG_HELP     = "h:help"
 	ARG_VER      = "v:version"
 )
@@ -64,6 +68,7 @@ const (
 	DATA_LOG_DIR              = "data:log-dir"
 	DATA_LOG_TYPE             = "data:log-type"
 	DATA_CHECK_DELAY          = "data:check-delay"
+	DATA_USE_INOTIFY          = "data:use-inotify"
 	HTTP_IP                   = "http:ip"
 	HTTP_PORT                 = "http:port"
 	HTTP_READ_TIMEOUT         = "http:read-timeout"
@@ -72,6 +77,7 @@ const (
 	HTTP_MAX_DELAY            = "http:max-delay"
 	PROCESSING_AUTO_HEAD      = "processing:auto-head"
 	PROCESSING_ALLOW_PROXYING = "processing:allow-proxying"
+	PROCESSING_FALLBACK       = "processing:fallback-upstream"
 	LOG_DIR                   = "log:dir"
 	LOG_FILE                  = "log:file"
 	LOG_PERMS                 = "log:perms"
@@ -86,13 +92,17 @@ const (
 	LISTING_HOST              = "listing:host"
 	LISTING_PORT              = "listing:port"
 	TEMPLATE_PATH             = "template:path"
+	ADMIN_ENABLED             = "admin:enabled"
+	ADMIN_PORT                = "admin:port"
+	ADMIN_JOURNAL_SIZE        = "admin:journal-size"
 )
 
 const (
-	COMMAND_RUN   = "run"
-	COMMAND_LIST  = "list"
-	COMMAND_MAKE  = "make"
-	COMMAND_CHECK = "check"
+	COMMAND_RUN    = "run"
+	COMMAND_LIST   = "list"
+	COMMAND_MAKE   = "make"
+	COMMAND_CHECK  = "check"
+	COMMAND_RECORD = "record"
 )
 
 // ////////////////////////////////////////////////////////////////////////////////// //
@@ -102,10 +112,15 @@ var argMap = arg.Map{
 	ARG_PORT:     &arg.V{Type: arg.BOOL, Min: MIN_PORT, Max: MAX_PORT},
 	ARG_DAEMON:   &arg.V{Type: arg.BOOL},
 	ARG_NO_COLOR: &arg.V{Type: arg.BOOL},
+	ARG_UPSTREAM: &arg.V{},
+	ARG_FORMAT:   &arg.V{},
 	ARG_HELP:     &arg.V{Type: arg.BOOL, Alias: "u:usage"},
 	ARG_VER:      &arg.V{Type: arg.BOOL, Alias: "ver"},
 }
 
+// serverObserver is rules observer used by running server
+var serverObserver *rules.Observer
+
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 func Init() {
@@ -213,6 +228,32 @@ func validateConfig() []error {
 		return nil
 	}
 
+	var adminPortChecker = func(config *knf.Config, prop string, value interface{}) error {
+		if !config.GetB(ADMIN_ENABLED) {
+			return nil
+		}
+
+		port := config.GetI(prop)
+
+		if port < MIN_PORT || port > MAX_PORT {
+			return fmt.Errorf("Property %s must be in range %d-%d.", prop, MIN_PORT, MAX_PORT)
+		}
+
+		return nil
+	}
+
+	var urlChecker = func(config *knf.Config, prop string, value interface{}) error {
+		if config.GetS(prop) == "" {
+			return nil
+		}
+
+		if !httputil.IsURL(config.GetS(prop)) {
+			return fmt.Errorf("Property %s must be valid URL.", prop)
+		}
+
+		return nil
+	}
+
 	return knf.Validate([]*knf.Validator{
 		&knf.Validator{DATA_RULE_DIR, knf.Empty, nil},
 		&knf.Validator{DATA_LOG_DIR, knf.Empty, nil},
@@ -242,6 +283,9 @@ func validateConfig() []error {
 
 		&knf.Validator{ACCESS_USER, userChecker, nil},
 		&knf.Validator{ACCESS_GROUP, groupChecker, nil},
+
+		&knf.Validator{PROCESSING_FALLBACK, urlChecker, nil},
+		&knf.Validator{ADMIN_PORT, adminPortChecker, nil},
 	})
 }
 
@@ -280,6 +324,9 @@ func execCommand(args []string) {
 	case COMMAND_CHECK:
 		checkMocks(args[1:])
 
+	case COMMAND_RECORD:
+		recordMocks(args[1:])
+
 	default:
 		printError(fmt.Sprintf("Unknown command %s", command))
 		os.Exit(1)
@@ -291,15 +338,49 @@ func registerSignalHandlers() {
 		signal.INT:  intSignalHandler,
 		signal.TERM: termSignalHandler,
 		signal.HUP:  hupSignalHandler,
+		signal.USR1: usr1SignalHandler,
 	}.TrackAsync()
 }
 
 func runServer() {
 	observer := rules.NewObserver(knf.GetS(DATA_RULE_DIR))
 	observer.AutoHead = knf.GetB(PROCESSING_AUTO_HEAD)
+	observer.UseInotify = knf.GetB(DATA_USE_INOTIFY, true)
 	observer.Start(knf.GetI(DATA_CHECK_DELAY))
 
-	err := server.Start(observer, APP+"/"+VER, arg.GetS(ARG_PORT))
+	serverObserver = observer
+
+	var journal *server.Journal
+
+	if knf.GetB(ADMIN_ENABLED) {
+		journal = server.NewJournal(knf.GetI(ADMIN_JOURNAL_SIZE, 1000))
+		go runAdminServer(observer, journal)
+	}
+
+	err := server.Start(observer, journal, APP+"/"+VER, arg.GetS(ARG_PORT))
+
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+}
+
+func runAdminServer(observer *rules.Observer, journal *server.Journal) {
+	err := admin.Start(observer, journal)
+
+	if err != nil {
+		log.Error("Can't start admin HTTP server: %v", err)
+	}
+}
+
+func recordMocks(args []string) {
+	var service = ""
+
+	if len(args) != 0 {
+		service = args[0]
+	}
+
+	err := server.StartRecorder(service, arg.GetS(ARG_UPSTREAM), arg.GetS(ARG_PORT))
 
 	if err != nil {
 		printError(err.Error())
@@ -348,12 +429,16 @@ func checkMocks(args []string) {
 		mock = args[0]
 	}
 
-	err := validator.Check(mock)
+	maxProblemType, err := validator.Check(mock, arg.GetS(ARG_FORMAT))
 
 	if err != nil {
 		printError(err.Error())
 		os.Exit(1)
 	}
+
+	if maxProblemType == validator.PROBLEM_ERR {
+		os.Exit(1)
+	}
 }
 
 func printError(message string) {
@@ -368,11 +453,13 @@ func printError(message string) {
 
 func intSignalHandler() {
 	log.Info("Received INT signal, shutdown...")
+	stopObserver()
 	os.Exit(0)
 }
 
 func termSignalHandler() {
 	log.Info("Received TERM signal, shutdown...")
+	stopObserver()
 	os.Exit(0)
 }
 
@@ -381,19 +468,38 @@ func hupSignalHandler() {
 	log.Reopen()
 }
 
+func usr1SignalHandler() {
+	if serverObserver == nil {
+		return
+	}
+
+	log.Info("Received USR1 signal, scenarios states reset")
+	serverObserver.ResetScenarios()
+}
+
+// stopObserver stop rules watching if server is running
+func stopObserver() {
+	if serverObserver != nil {
+		serverObserver.Stop()
+	}
+}
+
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 func showUsage() {
 	info := usage.NewInfo("")
 
 	info.AddCommand(COMMAND_RUN, "Run mockka server")
-	info.AddCommand(COMMAND_CHECK, "Check rule for problems", "mock-file")
+	info.AddCommand(COMMAND_CHECK, "Check rules for problems", "mock-file")
 	info.AddCommand(COMMAND_MAKE, "Create mock file from template", "mock-name")
 	info.AddCommand(COMMAND_LIST, "Show list of exist rules", "service-name")
+	info.AddCommand(COMMAND_RECORD, "Proxy requests to upstream and save them as mock files", "service-name")
 
 	info.AddOption(ARG_CONFIG, "Path to config file", "file")
 	info.AddOption(ARG_PORT, "Overwrite port", fmt.Sprintf("%d-%d", MIN_PORT, MAX_PORT))
 	info.AddOption(ARG_DAEMON, "Run server in daemon mode")
+	info.AddOption(ARG_UPSTREAM, "Upstream URL for record mode", "url")
+	info.AddOption(ARG_FORMAT, "Output format for check command (text/json/junit/checkstyle)", "format")
 	info.AddOption(ARG_NO_COLOR, "Disable colors in output")
 	info.AddOption(ARG_HELP, "Show this help message")
 	info.AddOption(ARG_VER, "Show version")
@@ -414,10 +520,25 @@ func showUsage() {
 	)
 
 	info.AddExample(
-		"check service1/test1",
+		"check service1",
 		"Check all rules of service service1",
 	)
 
+	info.AddExample(
+		"check",
+		"Check all rules in rule directory",
+	)
+
+	info.AddExample(
+		"check service1 --format junit",
+		"Check all rules of service service1 and print results as JUnit report",
+	)
+
+	info.AddExample(
+		"record service1 --upstream https://api.domain.com",
+		"Proxy all requests to https://api.domain.com and save them as mock files for service service1",
+	)
+
 	info.AddExample("list", "List all rules")
 	info.AddExample("list service1", "List service1 rules")
 
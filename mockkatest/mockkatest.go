@@ -0,0 +1,117 @@
+// Package mockkatest provides in-process Mockka server for using in Go tests
+package mockkatest
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/essentialkaos/mockka/rules"
+	"github.com/essentialkaos/mockka/server"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// JOURNAL_SIZE is max number of requests in test server journal
+const JOURNAL_SIZE = 10000
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Server is in-process Mockka server
+type Server struct {
+	URL      string          // Base URL of server (e.g. http://127.0.0.1:12345)
+	Observer *rules.Observer // Observer with server rules
+	Journal  *server.Journal // Journal with all processed requests
+	RuleDir  string          // Directory with mock files and response files
+
+	srv *httptest.Server
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// NewServer start new server with rules from given directory, if directory
+// is empty, server is started without rules
+func NewServer(ruleDir string) (*Server, error) {
+	return NewServerWithConfig(ruleDir, nil)
+}
+
+// NewServerWithConfig start new server with rules from given directory and
+// custom server configuration
+func NewServerWithConfig(ruleDir string, config *server.Config) (*Server, error) {
+	observer := rules.NewObserver(ruleDir)
+
+	if ruleDir != "" && !observer.Load() {
+		return nil, fmt.Errorf("Can't load rules from %s", ruleDir)
+	}
+
+	if config == nil {
+		config = &server.Config{AllowProxying: true, MaxDelay: 60.0}
+	}
+
+	journal := server.NewJournal(JOURNAL_SIZE)
+
+	s := &Server{
+		Observer: observer,
+		Journal:  journal,
+		RuleDir:  ruleDir,
+		srv:      httptest.NewServer(server.NewHandler(observer, journal, config)),
+	}
+
+	s.URL = s.srv.URL
+
+	return s, nil
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// AddRule add rule with given name (service/mock) and mock file content
+func (s *Server) AddRule(name, content string) error {
+	if strings.Count(name, "/") == 0 {
+		return errors.New("Rule name must be defined as <service-id>/<mock-name>")
+	}
+
+	service, mock, dir := rules.ParsePath(name)
+
+	rule, err := rules.ParseContent([]byte(content), s.RuleDir, service, dir, mock)
+
+	if err != nil {
+		return err
+	}
+
+	err = rule.LoadFiles()
+
+	if err != nil {
+		return err
+	}
+
+	return s.Observer.AddRule(rule)
+}
+
+// RemoveRule remove rule with given name (service/mock)
+func (s *Server) RemoveRule(name string) bool {
+	service, mock, dir := rules.ParsePath(name)
+
+	if dir != "" {
+		mock = dir + "/" + mock
+	}
+
+	return s.Observer.RemoveRule(service, mock)
+}
+
+// Count return number of processed requests for rule with given name (service/mock)
+func (s *Server) Count(name string) int {
+	return s.Journal.Count(&server.JournalFilter{Rule: name})
+}
+
+// Close shut down server
+func (s *Server) Close() {
+	s.srv.Close()
+}
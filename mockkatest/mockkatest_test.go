@@ -0,0 +1,71 @@
+package mockkatest
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MockkaTestSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&MockkaTestSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *MockkaTestSuite) TestServer(c *C) {
+	srv, err := NewServer("")
+
+	c.Assert(err, IsNil)
+
+	defer srv.Close()
+
+	c.Assert(srv.AddRule("test", "@REQUEST\nGET /test\n"), NotNil)
+	c.Assert(srv.AddRule("test/users", "@REQUEST\nGET /users/{id}\n\n@RESPONSE\nUser {{ .Param \"id\" }}\n\n@CODE\n201\n"), IsNil)
+
+	resp, err := http.Get(srv.URL + "/users/12")
+
+	c.Assert(err, IsNil)
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	c.Assert(resp.StatusCode, Equals, 201)
+	c.Assert(string(body), Equals, "User 12\n")
+	c.Assert(srv.Count("test/users"), Equals, 1)
+
+	c.Assert(srv.RemoveRule("test/users"), Equals, true)
+
+	resp, err = http.Get(srv.URL + "/users/12")
+
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, 599)
+}
+
+func (s *MockkaTestSuite) TestServerWithDir(c *C) {
+	srv, err := NewServer("../common/testdata")
+
+	c.Assert(err, IsNil)
+
+	defer srv.Close()
+
+	c.Assert(srv.Observer.GetRuleByName("test1", "dir1/test"), Not(IsNil))
+
+	_, err = NewServer("/_unknown_")
+
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,163 @@
+package rules
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"fmt"
+	"reflect"
+	"text/template/parse"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// CheckTemplate check response template for syntax errors, calls of unknown
+// methods of template data and calls with wrong number of arguments (data
+// is type of value which is passed to template while rendering)
+func CheckTemplate(resp *Response, data reflect.Type) error {
+	tmpl, err := resp.Template()
+
+	if err != nil {
+		return resp.TemplateError(err)
+	}
+
+	if tmpl.Tree != nil {
+		err = checkCalls(tmpl.Tree, tmpl.Tree.Root, data, true)
+
+		if err != nil {
+			return resp.TemplateError(err)
+		}
+	}
+
+	return nil
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// checkCalls check calls of template data methods in template nodes (dot is
+// false inside range and with blocks, because dot is changed there, so only
+// calls with $ are checked)
+func checkCalls(tree *parse.Tree, node parse.Node, data reflect.Type, dot bool) error {
+	var err error
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+
+		for _, child := range n.Nodes {
+			err = checkCalls(tree, child, data, dot)
+
+			if err != nil {
+				return err
+			}
+		}
+
+	case *parse.ActionNode:
+		return checkPipeCalls(tree, n.Pipe, data, dot)
+
+	case *parse.IfNode:
+		err = checkBranchCalls(tree, &n.BranchNode, data, dot, dot)
+
+	case *parse.RangeNode:
+		err = checkBranchCalls(tree, &n.BranchNode, data, dot, false)
+
+	case *parse.WithNode:
+		err = checkBranchCalls(tree, &n.BranchNode, data, dot, false)
+	}
+
+	return err
+}
+
+// checkBranchCalls check calls of template data methods in if, range and with
+// blocks (listDot is dot flag for block body, else block uses the same dot
+// as pipeline)
+func checkBranchCalls(tree *parse.Tree, n *parse.BranchNode, data reflect.Type, dot, listDot bool) error {
+	err := checkPipeCalls(tree, n.Pipe, data, dot)
+
+	if err == nil {
+		err = checkCalls(tree, n.List, data, listDot)
+	}
+
+	if err == nil {
+		err = checkCalls(tree, n.ElseList, data, dot)
+	}
+
+	return err
+}
+
+// checkPipeCalls check calls of template data methods in pipeline
+func checkPipeCalls(tree *parse.Tree, pipe *parse.PipeNode, data reflect.Type, dot bool) error {
+	if pipe == nil {
+		return nil
+	}
+
+	for index, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			if argPipe, ok := arg.(*parse.PipeNode); ok {
+				err := checkPipeCalls(tree, argPipe, data, dot)
+
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		var name string
+
+		switch arg := cmd.Args[0].(type) {
+		case *parse.FieldNode:
+			if !dot || len(arg.Ident) != 1 {
+				continue
+			}
+
+			name = arg.Ident[0]
+
+		case *parse.VariableNode:
+			// $ is always template data
+			if len(arg.Ident) != 2 || arg.Ident[0] != "$" {
+				continue
+			}
+
+			name = arg.Ident[1]
+
+		default:
+			continue
+		}
+
+		node := cmd.Args[0]
+		method, ok := data.MethodByName(name)
+
+		if !ok {
+			return templateNodeError(tree, node, "unknown method %s", name)
+		}
+
+		argsNum := len(cmd.Args) - 1
+
+		// Result of previous command is passed as last argument
+		if index != 0 {
+			argsNum++
+		}
+
+		// First input argument is receiver
+		if argsNum != method.Type.NumIn()-1 {
+			return templateNodeError(
+				tree, node, "wrong number of args for %s: want %d got %d",
+				name, method.Type.NumIn()-1, argsNum,
+			)
+		}
+	}
+
+	return nil
+}
+
+// templateNodeError create error in template error format for given node
+func templateNodeError(tree *parse.Tree, node parse.Node, format string, args ...interface{}) error {
+	location, _ := tree.ErrorContext(node)
+	return fmt.Errorf("template: %s: %s", location, fmt.Sprintf(format, args...))
+}
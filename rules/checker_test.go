@@ -0,0 +1,90 @@
+package rules
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"reflect"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+type CheckerSuite struct{}
+
+// checkerData is template data used for checking methods calls
+type checkerData struct{}
+
+func (d *checkerData) Param(name string) string        { return "" }
+func (d *checkerData) Query(name string) string        { return "" }
+func (d *checkerData) QueryIs(name, value string) bool { return false }
+func (d *checkerData) Header(name string) string       { return "" }
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&CheckerSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *CheckerSuite) TestCheckTemplate(c *C) {
+	checkResponse := func(content string) error {
+		rule, err := ParseContent([]byte(content), "", "service", "", "test")
+
+		c.Assert(err, IsNil)
+
+		return CheckTemplate(rule.Responses[DEFAULT], reflect.TypeOf(&checkerData{}))
+	}
+
+	err := checkResponse("@REQUEST\nGET /users/{id}\n\n@RESPONSE\n{\"id\":{{ .Param \"id\" }}}\n")
+
+	c.Assert(err, IsNil)
+
+	err = checkResponse("@REQUEST\nGET /users/{id}\n\n@RESPONSE\n{\n\n# Comment\n  \"id\":{{ .Querry \"id\" }}\n}\n")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "line 8:11: unknown method Querry")
+
+	err = checkResponse("@REQUEST\nGET /users\n\n@RESPONSE\n{{ if .QueryIs \"debug\" \"1\" }}{{ .Query }}{{ end }}\n")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "line 5:33: wrong number of args for Query: want 1 got 0")
+
+	err = checkResponse("@REQUEST\nGET /users\n\n@RESPONSE\n{{ .Query \"name\" | .Header }}\n")
+
+	c.Assert(err, IsNil)
+
+	err = checkResponse("@REQUEST\nGET /users\n\n@RESPONSE\n{{ .Query \"name\" | .QueryIs \"a\" \"b\" }}\n")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "line 5:20: wrong number of args for QueryIs: want 2 got 3")
+
+	// Dot is changed inside range and with blocks, but not in else blocks
+	err = checkResponse("@REQUEST\nGET /users\n\n@RESPONSE\n{{ range .Query \"ids\" }}{{ .Unknown }}{{ end }}\n")
+
+	c.Assert(err, IsNil)
+
+	err = checkResponse("@REQUEST\nGET /users\n\n@RESPONSE\n{{ with .Query \"id\" }}{{ $.Querry \"id\" }}{{ end }}\n")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "line 5:27: unknown method Querry")
+
+	err = checkResponse("@REQUEST\nGET /users\n\n@RESPONSE\n{{ range .Query \"ids\" }}{{ else }}{{ .Querry \"id\" }}{{ end }}\n")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "line 5:38: unknown method Querry")
+
+	err = checkResponse("@REQUEST\nGET /users\n\n@RESPONSE\n{{ with .Query \"id\" }}{{ else }}{{ with .Header \"X\" }}{{ $.Query }}{{ end }}{{ end }}\n")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "line 5:59: wrong number of args for Query: want 1 got 0")
+
+	_, err = ParseContent([]byte("@REQUEST\nGET /users\n\n@RESPONSE\n\n{{ .Query \"name\" }\n"), "", "service", "", "test")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't parse file service/test.mock:6 - template in section RESPONSE is malformed: unexpected \"}\" in operand (\"{{ .Query \\\"name\\\" }\")")
+}
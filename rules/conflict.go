@@ -0,0 +1,128 @@
+package rules
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"strings"
+
+	"github.com/essentialkaos/mockka/urlutil"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+const (
+	CONFLICT_DUPLICATE = "duplicate" // Rules have same host, method, url and matchers
+	CONFLICT_OVERLAP   = "overlap"   // Wildcard rules with same priority match same urls
+	CONFLICT_SHADOW    = "shadow"    // Rule is unreachable, all requests are handled by other rule
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Conflict contains info about conflict between two rules
+type Conflict struct {
+	Type  string // Conflict type (duplicate/overlap/shadow)
+	Rule  *Rule  // Rule with problem
+	Other *Rule  // Conflicting rule
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// FindConflicts return conflicts of given rule with other rules from list
+func FindConflicts(rule *Rule, list []*Rule) []*Conflict {
+	var result []*Conflict
+
+	for _, other := range list {
+		if other == rule || other.Path == rule.Path {
+			continue
+		}
+
+		switch {
+		case isDuplicate(rule, other):
+			result = append(result, &Conflict{CONFLICT_DUPLICATE, rule, other})
+		case isOverlap(rule, other):
+			result = append(result, &Conflict{CONFLICT_OVERLAP, rule, other})
+		case isShadowed(rule, other):
+			result = append(result, &Conflict{CONFLICT_SHADOW, rule, other})
+		}
+	}
+
+	return result
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// isDuplicate return true if rules have same URI, request matchers
+// and required scenario state
+func isDuplicate(r1, r2 *Rule) bool {
+	return r1.Request.URI == r2.Request.URI &&
+		r1.Request.SameMatchers(r2.Request) &&
+		sameState(r1, r2)
+}
+
+// isOverlap return true if wildcard rules with same priority match same urls
+func isOverlap(r1, r2 *Rule) bool {
+	if !r1.IsWildcard || !r2.IsWildcard {
+		return false
+	}
+
+	if r1.Request.Method != r2.Request.Method || r1.Request.Host != r2.Request.Host {
+		return false
+	}
+
+	if !r1.Request.SameMatchers(r2.Request) || !sameState(r1, r2) {
+		return false
+	}
+
+	// Rules with different priority or specificity can intersect,
+	// because order of checking is always defined
+	if compareRules(r1, r2) != 0 {
+		return false
+	}
+
+	return urlutil.EqualPatterns(r1.Request.NURL, r2.Request.NURL)
+}
+
+// isShadowed return true if wildcard rule can't be used because all requests
+// which fit it are handled by other wildcard rule checked before
+func isShadowed(rule, other *Rule) bool {
+	if !rule.IsWildcard || !other.IsWildcard {
+		return false
+	}
+
+	if rule.Request.Method != other.Request.Method {
+		return false
+	}
+
+	if other.Request.Host != "" && other.Request.Host != rule.Request.Host {
+		return false
+	}
+
+	// Other rule must handle all requests without any conditions
+	if other.Request.MatchersNum() != 0 || other.RequiredState != "" {
+		return false
+	}
+
+	order := compareRules(other, rule)
+
+	if order > 0 || (order == 0 && other.Path > rule.Path) {
+		return false
+	}
+
+	if urlutil.IsRegexp(rule.Request.NURL) || urlutil.IsRegexp(other.Request.NURL) {
+		return false
+	}
+
+	// Named params match only one path segment, but wildcard can match
+	// any number of segments
+	if urlutil.HasParams(other.Request.NURL) && strings.Contains(rule.Request.NURL, "*") {
+		return false
+	}
+
+	// Wildcards in pattern are matched by wildcards in other pattern
+	return other.Request.MatchURL(rule.Request.NURL)
+}
@@ -0,0 +1,512 @@
+package rules
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/essentialkaos/mockka/urlutil"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+const (
+	MATCH_EXACT    = "exact"
+	MATCH_CONTAINS = "contains"
+	MATCH_REGEX    = "regex"
+	MATCH_JSON     = "json"
+)
+
+const (
+	SOURCE_QUERY  = "query"
+	SOURCE_HEADER = "header"
+	SOURCE_COOKIE = "cookie"
+	SOURCE_PARAM  = "param"
+	SOURCE_BODY   = "body"
+)
+
+// MAX_BODY_SIZE is max size of request body which is read for matching
+const MAX_BODY_SIZE = 1024 * 1024
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// ErrBodyTooLarge is returned by ReadBody if request body is bigger
+// than MAX_BODY_SIZE
+var ErrBodyTooLarge = fmt.Errorf("Request body is bigger than %d bytes", MAX_BODY_SIZE)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+type BodyMatcher struct {
+	Type    string // Matching type (exact/contains/regex/json)
+	Content string // Raw pattern from mock file
+
+	regexp *regexp.Regexp
+	json   interface{}
+}
+
+type ValueMatcher struct {
+	Name  string // Header or cookie name
+	Value string // Raw value pattern (empty - any value, ~ prefix - regexp)
+
+	regexp *regexp.Regexp
+}
+
+// bodyReader is request body with data read for matching and unread rest of body
+type bodyReader struct {
+	io.Reader
+	io.Closer
+}
+
+type Condition struct {
+	Source  string        // Value source (query/header/cookie/param/body)
+	Matcher *ValueMatcher // Value matcher (name is query param, header, cookie, named param or JSON path)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// String return string with body matcher info
+func (m *BodyMatcher) String() string {
+	if m == nil {
+		return "Nil"
+	}
+
+	return fmt.Sprintf("Type: %s | ContentSyms: %d", m.Type, len(m.Content))
+}
+
+// Match return true if request body fits matcher
+func (m *BodyMatcher) Match(body []byte) bool {
+	if m == nil {
+		return true
+	}
+
+	switch m.Type {
+	case MATCH_CONTAINS:
+		return strings.Contains(string(body), m.Content)
+
+	case MATCH_REGEX:
+		return m.regexp.Match(body)
+
+	case MATCH_JSON:
+		var data interface{}
+
+		if json.Unmarshal(body, &data) != nil {
+			return false
+		}
+
+		return isJSONSubset(m.json, data)
+	}
+
+	return strings.TrimSpace(string(body)) == m.Content
+}
+
+// Equal return true if both matchers check the same thing
+func (m *BodyMatcher) Equal(matcher *BodyMatcher) bool {
+	if m == nil || matcher == nil {
+		return m == nil && matcher == nil
+	}
+
+	return m.Type == matcher.Type && m.Content == matcher.Content
+}
+
+// String return string with value matcher info
+func (m *ValueMatcher) String() string {
+	if m == nil {
+		return "Nil"
+	}
+
+	return m.Name + ":" + m.Value
+}
+
+// Match return true if value fits matcher
+func (m *ValueMatcher) Match(value string, exist bool) bool {
+	switch {
+	case !exist:
+		return false
+	case m.Value == "":
+		return true
+	case m.regexp != nil:
+		return m.regexp.MatchString(value)
+	}
+
+	return m.Value == value
+}
+
+// String return string with condition info
+func (c *Condition) String() string {
+	if c == nil {
+		return "Nil"
+	}
+
+	if c.Matcher.Value == "" {
+		return c.Source + ":" + c.Matcher.Name
+	}
+
+	return c.Source + ":" + c.Matcher.Name + "=" + c.Matcher.Value
+}
+
+// Match return true if request with given body fits condition
+func (c *Condition) Match(r *http.Request, body []byte, params map[string]string) bool {
+	value, exist := getRequestValue(r, body, params, c.Source, c.Matcher.Name)
+	return c.Matcher.Match(value, exist)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// fit return true if request fits all response conditions
+func (r *Response) fit(req *http.Request, body []byte, params map[string]string) bool {
+	for _, c := range r.When {
+		if !c.Match(req, body, params) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Match return true if request with given body fits all request matchers
+func (r *Request) Match(req *http.Request, body []byte) bool {
+	for _, m := range r.Headers {
+		_, exist := req.Header[http.CanonicalHeaderKey(m.Name)]
+
+		if !m.Match(req.Header.Get(m.Name), exist) {
+			return false
+		}
+	}
+
+	for _, m := range r.Cookies {
+		var value string
+
+		cookie, err := req.Cookie(m.Name)
+
+		if err == nil {
+			value = cookie.Value
+		}
+
+		if !m.Match(value, err == nil) {
+			return false
+		}
+	}
+
+	if r.Body == nil {
+		return true
+	}
+
+	return r.Body.Match(body)
+}
+
+// MatchURL return true if url fits request url pattern
+func (r *Request) MatchURL(url string) bool {
+	if r.re == nil {
+		return urlutil.Match(r.NURL, url)
+	}
+
+	return urlutil.MatchCompiled(r.re, r.NURL, url)
+}
+
+// URLParams return values of named params (or named capture groups for
+// regexp url) from url
+func (r *Request) URLParams(url string) map[string]string {
+	if r.re == nil {
+		return urlutil.ExtractParams(r.NURL, url)
+	}
+
+	return urlutil.ExtractCompiledParams(r.re, r.NURL, url)
+}
+
+// MatchersNum return number of request matchers
+func (r *Request) MatchersNum() int {
+	result := len(r.Headers) + len(r.Cookies)
+
+	if r.Body != nil {
+		result++
+	}
+
+	return result
+}
+
+// SameMatchers return true if both requests have the same matchers
+func (r *Request) SameMatchers(req *Request) bool {
+	if !r.Body.Equal(req.Body) {
+		return false
+	}
+
+	// Header names are case-insensitive, but cookie names are not
+	return equalValueMatchers(r.Headers, req.Headers, true) &&
+		equalValueMatchers(r.Cookies, req.Cookies, false)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// compile validate matcher type and prepare pattern for matching
+func (m *BodyMatcher) compile() error {
+	var err error
+
+	m.Content = strings.TrimSpace(m.Content)
+
+	switch m.Type {
+	case MATCH_EXACT, MATCH_CONTAINS:
+		return nil
+
+	case MATCH_REGEX:
+		m.regexp, err = regexp.Compile(m.Content)
+
+	case MATCH_JSON:
+		err = json.Unmarshal([]byte(m.Content), &m.json)
+
+	default:
+		return fmt.Errorf("unknown matching type %s", m.Type)
+	}
+
+	return err
+}
+
+// parseValueMatcher parse matcher from string (name:value)
+func parseValueMatcher(data string) (*ValueMatcher, error) {
+	var err error
+
+	matcher := &ValueMatcher{}
+	data = strings.TrimSpace(data)
+	index := strings.Index(data, ":")
+
+	if index == -1 {
+		matcher.Name = data
+	} else {
+		matcher.Name = strings.TrimSpace(data[:index])
+		matcher.Value = strings.TrimSpace(data[index+1:])
+	}
+
+	if matcher.Name == "" {
+		return nil, fmt.Errorf("matcher name is empty")
+	}
+
+	if strings.HasPrefix(matcher.Value, "~") {
+		matcher.regexp, err = regexp.Compile(matcher.Value[1:])
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return matcher, nil
+}
+
+// parseCondition parse condition from string (source:name=value)
+func parseCondition(data string) (*Condition, error) {
+	data = strings.TrimSpace(data)
+	index := strings.Index(data, ":")
+
+	if index == -1 {
+		return nil, fmt.Errorf("condition source is not set")
+	}
+
+	source := strings.ToLower(strings.TrimSpace(data[:index]))
+
+	switch source {
+	case SOURCE_QUERY, SOURCE_HEADER, SOURCE_COOKIE, SOURCE_PARAM, SOURCE_BODY:
+	default:
+		return nil, fmt.Errorf("unknown condition source %s", source)
+	}
+
+	// Reuse value matcher syntax, name and value in condition
+	// are separated by equal sign
+	matcher, err := parseValueMatcher(strings.Replace(data[index+1:], "=", ":", 1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Condition{Source: source, Matcher: matcher}, nil
+}
+
+// equalValueMatchers return true if both slices contains same matchers,
+// names are compared case-insensitively if ignoreCase is true
+func equalValueMatchers(m1, m2 []*ValueMatcher, ignoreCase bool) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+
+	var s1, s2 []string
+
+	for i := range m1 {
+		name1, name2 := m1[i].Name, m2[i].Name
+
+		if ignoreCase {
+			name1, name2 = strings.ToLower(name1), strings.ToLower(name2)
+		}
+
+		s1 = append(s1, name1+":"+m1[i].Value)
+		s2 = append(s2, name2+":"+m2[i].Value)
+	}
+
+	sort.Strings(s1)
+	sort.Strings(s2)
+
+	return strings.Join(s1, "\n") == strings.Join(s2, "\n")
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// getRequestValue return value from request by source and name (query param,
+// header, cookie, named param or JSON path)
+func getRequestValue(r *http.Request, body []byte, params map[string]string, source, name string) (string, bool) {
+	var value string
+	var exist bool
+
+	switch source {
+	case SOURCE_QUERY:
+		var values []string
+		values, exist = r.URL.Query()[name]
+
+		if exist && len(values) != 0 {
+			value = values[0]
+		}
+
+	case SOURCE_HEADER:
+		_, exist = r.Header[http.CanonicalHeaderKey(name)]
+		value = r.Header.Get(name)
+
+	case SOURCE_COOKIE:
+		cookie, err := r.Cookie(name)
+
+		if err == nil {
+			value, exist = cookie.Value, true
+		}
+
+	case SOURCE_PARAM:
+		value, exist = params[name]
+
+	case SOURCE_BODY:
+		var data interface{}
+
+		if json.Unmarshal(body, &data) == nil {
+			value, exist = GetJSONValue(data, name)
+		}
+	}
+
+	return value, exist
+}
+
+// ReadBody read request body for matching and restore it for the next readers
+// (ErrBodyTooLarge is returned if body is bigger than MAX_BODY_SIZE)
+func ReadBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MAX_BODY_SIZE+1))
+
+	// Rest of body is not read, so next readers get full body
+	r.Body = &bodyReader{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > MAX_BODY_SIZE {
+		return nil, ErrBodyTooLarge
+	}
+
+	return body, nil
+}
+
+// GetJSONValue return value from decoded JSON data by path (user.roles.0.name)
+func GetJSONValue(data interface{}, path string) (string, bool) {
+	for _, key := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		switch d := data.(type) {
+		case map[string]interface{}:
+			value, ok := d[key]
+
+			if !ok {
+				return "", false
+			}
+
+			data = value
+
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+
+			if err != nil || index < 0 || index >= len(d) {
+				return "", false
+			}
+
+			data = d[index]
+
+		default:
+			return "", false
+		}
+	}
+
+	switch d := data.(type) {
+	case nil:
+		return "", true
+	case string:
+		return d, true
+	case float64:
+		return strconv.FormatFloat(d, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(d), true
+	}
+
+	result, _ := json.Marshal(data)
+
+	return string(result), true
+}
+
+// isJSONSubset return true if all data from pattern exists in given value
+func isJSONSubset(pattern, value interface{}) bool {
+	switch p := pattern.(type) {
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+
+		if !ok {
+			return false
+		}
+
+		for key, item := range p {
+			vi, ok := v[key]
+
+			if !ok || !isJSONSubset(item, vi) {
+				return false
+			}
+		}
+
+		return true
+
+	case []interface{}:
+		v, ok := value.([]interface{})
+
+		if !ok {
+			return false
+		}
+
+	PATTERNLOOP:
+		for _, item := range p {
+			for _, vi := range v {
+				if isJSONSubset(item, vi) {
+					continue PATTERNLOOP
+				}
+			}
+
+			return false
+		}
+
+		return true
+	}
+
+	return reflect.DeepEqual(pattern, value)
+}
@@ -8,9 +8,12 @@ package rules
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 import (
+	"fmt"
 	"net/http"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"pkg.re/essentialkaos/ek.v3/fsutil"
@@ -23,150 +26,278 @@ import (
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
+// EVENTS_DELAY is delay for collecting file system events before rules reloading
+const EVENTS_DELAY = 100 * time.Millisecond
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
 // RuleMap is map key -> rule
 type RuleMap map[string]*Rule
 
+// RuleList is slice with rules sorted by priority
+type RuleList []*Rule
+
+// RuleListMap is map key -> rules with same key
+type RuleListMap map[string]RuleList
+
 type Observer struct {
-	AutoHead bool
+	AutoHead   bool
+	UseInotify bool
+
+	current atomic.Value    // current rules snapshot (*snapshot)
+	errMap  map[string]bool // full name -> has error
 
-	uriMap  RuleMap            // host+method+url -> rule
+	scenarios *scenarioStates // current scenarios states
+
+	ruleDir string        // dir with all mock files
+	works   bool          // observer watching marker
+	watcher *watcher      // inotify watcher (nil - polling is used)
+	stop    chan struct{} // channel for stopping rules watching
+	mu      sync.Mutex    // lock for rules loading
+}
+
+// snapshot is immutable set of loaded rules
+//
+// Every rules reload creates new snapshot, which atomically replace current one,
+// so requests always processed with consistent set of rules
+type snapshot struct {
+	uriMap  RuleListMap        // host+method+url -> rules
 	pathMap RuleMap            // full path -> rule
-	wcMap   RuleMap            // full path -> rule (only wildcard)
+	wcList  RuleList           // wildcard rules sorted by priority
 	nameMap map[string]RuleMap // service -> full name (with dir) -> rule
-	errMap  map[string]bool    // full name -> has error
 	srvMap  map[string]bool    // service name -> true
+}
 
-	ruleDir string // dir with all mock files
-	works   bool
+// fsEvent contains info about changed file or directory
+type fsEvent struct {
+	Path  string // Full path to changed file
+	IsDir bool   // Directory marker
 }
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 // NewObserver create new observer struct
 func NewObserver(ruleDir string) *Observer {
-	return &Observer{
-		ruleDir: ruleDir,
-		uriMap:  make(RuleMap),
-		pathMap: make(RuleMap),
-		wcMap:   make(RuleMap),
-		nameMap: make(map[string]RuleMap),
-		errMap:  make(map[string]bool),
-		srvMap:  make(map[string]bool),
+	obs := &Observer{
+		ruleDir:   ruleDir,
+		errMap:    make(map[string]bool),
+		scenarios: newScenarioStates(),
 	}
+
+	obs.current.Store(newSnapshot())
+
+	return obs
 }
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 // Start start observer
 func (obs *Observer) Start(checkDelay int) {
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+
 	if obs.works {
 		return
 	}
 
 	obs.works = true
+	obs.stop = make(chan struct{})
+
+	if obs.UseInotify {
+		w, err := newWatcher(obs.ruleDir)
 
-	go obs.watch(time.Duration(checkDelay) * time.Second)
+		if err == nil {
+			obs.watcher = w
+			go obs.listen(w, time.Duration(checkDelay)*time.Second, obs.stop)
+			return
+		}
+
+		log.Warn("Can't use inotify for rules watching (%v), polling will be used instead", err)
+	}
+
+	go obs.watch(time.Duration(checkDelay)*time.Second, obs.stop)
+}
+
+// Stop stop rules watching and close inotify instance
+func (obs *Observer) Stop() {
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+
+	if !obs.works {
+		return
+	}
+
+	obs.works = false
+
+	close(obs.stop)
+
+	if obs.watcher != nil {
+		obs.watcher.close()
+		obs.watcher = nil
+	}
 }
 
 // Load load and parse all rules
 func (obs *Observer) Load() bool {
-	var ok = true
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
 
-	for _, r := range obs.uriMap {
-		if !fsutil.IsExist(r.Path) {
-			delete(obs.uriMap, r.Request.URI)
-			delete(obs.wcMap, r.Path)
-			delete(obs.errMap, r.Path)
-			delete(obs.pathMap, r.Path)
-			delete(obs.nameMap[r.Service], r.FullName)
+	current := obs.getSnapshot()
+	snap := current.clone()
+	ok := obs.load(current, snap)
 
-			// If no one rule found for service, remove it's own map
-			if len(obs.nameMap[r.Service]) == 0 {
-				delete(obs.nameMap, r.Service)
-			}
+	obs.watchExternalFiles(snap)
+	obs.current.Store(snap)
 
-			log.Info("Rule %s unloaded (mock file deleted)", r.PrettyPath)
+	return ok
+}
 
-			continue
-		}
+// ReloadFiles reload rules which use given files (mock files or response files)
+func (obs *Observer) ReloadFiles(files ...string) {
+	var events []fsEvent
 
-		mtime, _ := fsutil.GetMTime(r.Path)
+	for _, file := range files {
+		events = append(events, fsEvent{Path: path.Clean(file)})
+	}
 
-		if r.ModTime.UnixNano() != mtime.UnixNano() {
-			rule, err := Parse(obs.ruleDir, r.Service, r.Dir, r.Name)
+	obs.reload(events)
+}
 
-			if err != nil {
-				log.Error(err.Error())
-				ok = false
-				continue
-			}
+// AddRule add rule created in runtime without mock file (rule with same
+// name will be replaced)
+func (obs *Observer) AddRule(rule *Rule) error {
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
 
-			// URI can be changed, remove rule from uri map anyway
-			delete(obs.uriMap, r.Request.URI)
-			delete(obs.errMap, r.Path)
+	current := obs.getSnapshot()
+	snap := current.clone()
 
-			if r.IsWildcard {
-				delete(obs.wcMap, r.Path)
-			}
-
-			obs.uriMap[rule.Request.URI] = rule
-			obs.pathMap[rule.Path] = rule
+	if r := current.pathMap[rule.Path]; r != nil {
+		obs.removeRule(snap, r)
+	}
 
-			if rule.IsWildcard {
-				obs.wcMap[rule.Path] = rule
-			}
+	err := checkIntersection(snap, rule)
 
-			log.Info("Rule %s reloaded", rule.PrettyPath)
-		}
+	if err != nil {
+		return err
 	}
 
-	if !fsutil.CheckPerms("DRX", obs.ruleDir) {
-		log.Error("Can't read directory with rules (%s)", obs.ruleDir)
+	rule.InMemory = true
+
+	obs.addRule(snap, rule)
+	obs.current.Store(snap)
+
+	log.Info("Rule %s loaded (in memory)", rule.PrettyPath)
+	logWarnings(rule)
+
+	return nil
+}
+
+// RemoveRule unload rule with given name (mock file will not be removed)
+func (obs *Observer) RemoveRule(service, name string) bool {
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+
+	current := obs.getSnapshot()
+	rule := current.nameMap[service][name]
+
+	if rule == nil {
 		return false
 	}
 
-	rules := fsutil.ListAllFiles(
-		obs.ruleDir, true,
-		&fsutil.ListingFilter{
-			MatchPatterns: []string{"*.mock"},
-		},
-	)
+	snap := current.clone()
 
-	if len(rules) == 0 {
-		return ok
+	obs.removeRule(snap, rule)
+
+	log.Info("Rule %s unloaded", rule.PrettyPath)
+
+	// In memory rule can hide rule from mock file with same name
+	if rule.InMemory && fsutil.IsExist(rule.Path) {
+		obs.checkRules(snap, []string{path.Join(rule.Service, rule.FullName) + ".mock"})
 	}
 
-	if !obs.checkRules(rules) {
-		ok = false
+	obs.current.Store(snap)
+
+	return true
+}
+
+// CheckRule check rule for intersection with loaded rules (rule with
+// same name is ignored)
+func (obs *Observer) CheckRule(rule *Rule) error {
+	current := obs.getSnapshot()
+	snap := current.clone()
+
+	if r := current.pathMap[rule.Path]; r != nil {
+		snap.remove(r)
 	}
 
-	return ok
+	return checkIntersection(snap, rule)
 }
 
-// GetRule return rule for request
-func (obs *Observer) GetRule(r *http.Request) *Rule {
+// GetRule return rule for request with given body (body can be read by ReadBody)
+func (obs *Observer) GetRule(r *http.Request, body []byte) *Rule {
+	snap := obs.getSnapshot()
 	autoHead := obs.AutoHead && r.Method == "HEAD"
-	return findRule(obs.uriMap, obs.wcMap, r, autoHead)
+
+	return findRule(snap.uriMap, snap.wcList, obs.scenarios, r, body, autoHead)
+}
+
+// ApplyNewState change scenario state to state defined in rule (must be
+// called only after response was successfully sent)
+func (obs *Observer) ApplyNewState(rule *Rule) {
+	if rule == nil || rule.Scenario == "" || rule.NewState == "" {
+		return
+	}
+
+	obs.scenarios.set(rule.Scenario, rule.NewState)
+
+	log.Debug("Scenario %s state changed to %s by rule %s", rule.Scenario, rule.NewState, rule.PrettyPath)
+}
+
+// GetScenarios return map with current states of scenarios (scenarios in
+// initial state are not included)
+func (obs *Observer) GetScenarios() map[string]string {
+	return obs.scenarios.all()
+}
+
+// SetScenarioState set current state of scenario
+func (obs *Observer) SetScenarioState(scenario, state string) {
+	obs.scenarios.set(scenario, state)
+}
+
+// ResetScenarios reset states of given scenarios to initial state (or
+// all scenarios if names is not set)
+func (obs *Observer) ResetScenarios(scenarios ...string) {
+	obs.scenarios.reset(scenarios...)
 }
 
 // GetRuleByName return rule by full name (i.e. service/dir/mock>)
 func (obs *Observer) GetRuleByName(service, name string) *Rule {
-	if !obs.srvMap[service] {
+	snap := obs.getSnapshot()
+
+	if !snap.srvMap[service] {
 		return nil
 	}
 
-	return obs.nameMap[service][name]
+	return snap.nameMap[service][name]
+}
+
+// RuleDir return path to directory with mock files
+func (obs *Observer) RuleDir() string {
+	return obs.ruleDir
 }
 
 // GetServices return services names list
 func (obs *Observer) GetServices() []string {
 	var result []string
 
-	if len(obs.srvMap) == 0 {
+	snap := obs.getSnapshot()
+
+	if len(snap.srvMap) == 0 {
 		return result
 	}
 
-	for service := range obs.srvMap {
+	for service := range snap.srvMap {
 		result = append(result, service)
 	}
 
@@ -179,11 +310,13 @@ func (obs *Observer) GetServices() []string {
 func (obs *Observer) GetServiceRulesNames(service string) []string {
 	var result []string
 
-	if !obs.srvMap[service] {
+	snap := obs.getSnapshot()
+
+	if !snap.srvMap[service] {
 		return result
 	}
 
-	for name := range obs.nameMap[service] {
+	for name := range snap.nameMap[service] {
 		result = append(result, name)
 	}
 
@@ -194,10 +327,206 @@ func (obs *Observer) GetServiceRulesNames(service string) []string {
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
-func (obs *Observer) checkRules(rules []string) bool {
+// getSnapshot return current rules snapshot
+func (obs *Observer) getSnapshot() *snapshot {
+	return obs.current.Load().(*snapshot)
+}
+
+// load check current snapshot rules for changes and load new rules
+// into new snapshot
+func (obs *Observer) load(current, snap *snapshot) bool {
+	var ok = true
+
+	for _, r := range current.pathMap {
+		if !obs.updateRule(snap, r, false) {
+			ok = false
+		}
+	}
+
+	if !fsutil.CheckPerms("DRX", obs.ruleDir) {
+		log.Error("Can't read directory with rules (%s)", obs.ruleDir)
+		return false
+	}
+
+	rules := fsutil.ListAllFiles(
+		obs.ruleDir, true,
+		&fsutil.ListingFilter{
+			MatchPatterns: []string{"*.mock"},
+		},
+	)
+
+	if len(rules) == 0 {
+		return ok
+	}
+
+	// Sort rules for loading them always in the same order
+	sort.Strings(rules)
+
+	if !obs.checkRules(snap, rules) {
+		ok = false
+	}
+
+	return ok
+}
+
+// reload reload only rules affected by file system changes
+func (obs *Observer) reload(events []fsEvent) {
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+
+	current := obs.getSnapshot()
+	snap := current.clone()
+	files := make(map[string]bool)
+
+	for _, event := range events {
+		// Directory was created, moved or deleted, so we should check all rules
+		if event.IsDir {
+			obs.load(current, snap)
+			obs.watchExternalFiles(snap)
+			obs.current.Store(snap)
+			return
+		}
+
+		files[event.Path] = true
+	}
+
+	for file := range files {
+		obs.reloadFile(current, snap, file)
+	}
+
+	obs.watchExternalFiles(snap)
+	obs.current.Store(snap)
+}
+
+// reloadFile reload rules which use given file
+func (obs *Observer) reloadFile(current, snap *snapshot, file string) {
+	// Files outside of rules dir can be used only as response files
+	if !strings.HasSuffix(file, ".mock") || !obs.isRuleDirPath(file) {
+		obs.reloadDependentRules(current, snap, file)
+		return
+	}
+
+	// Mock file was changed, so we should show parsing errors again
+	delete(obs.errMap, file)
+
+	r := current.pathMap[file]
+
+	if r != nil {
+		obs.updateRule(snap, r, true)
+		return
+	}
+
+	if !fsutil.IsExist(file) {
+		return
+	}
+
+	rulePath := strings.TrimPrefix(file, path.Clean(obs.ruleDir)+"/")
+
+	obs.checkRules(snap, []string{rulePath})
+}
+
+// reloadDependentRules reload rules which use given file as response body
+// and try to load rules which wasn't loaded due to errors
+func (obs *Observer) reloadDependentRules(current, snap *snapshot, file string) {
+	for _, r := range current.pathMap {
+		if _, ok := r.Files[file]; ok {
+			// Response file was changed, so we should show loading errors again
+			delete(obs.errMap, r.Path)
+			obs.updateRule(snap, r, true)
+		}
+	}
+
+	var rulePaths []string
+
+	for fullPath := range obs.errMap {
+		if current.pathMap[fullPath] == nil && fsutil.IsExist(fullPath) {
+			rulePaths = append(rulePaths, strings.TrimPrefix(fullPath, path.Clean(obs.ruleDir)+"/"))
+		}
+	}
+
+	if len(rulePaths) != 0 {
+		sort.Strings(rulePaths)
+		obs.checkRules(snap, rulePaths)
+	}
+}
+
+// watchExternalFiles add inotify watches for dirs with response files placed
+// outside of rules dir
+func (obs *Observer) watchExternalFiles(snap *snapshot) {
+	if obs.watcher == nil {
+		return
+	}
+
+	for _, r := range snap.pathMap {
+		for file := range r.Files {
+			if obs.isRuleDirPath(file) {
+				continue
+			}
+
+			err := obs.watcher.watchDir(path.Dir(file))
+
+			if err != nil {
+				log.Error("Can't watch directory %s: %v", path.Dir(file), err)
+			}
+		}
+	}
+}
+
+// isRuleDirPath return true if given file is placed inside rules dir
+func (obs *Observer) isRuleDirPath(file string) bool {
+	return strings.HasPrefix(path.Clean(file), path.Clean(obs.ruleDir)+"/")
+}
+
+// updateRule reload rule if mock file was changed and unload rule if
+// mock file was deleted
+func (obs *Observer) updateRule(snap *snapshot, r *Rule, force bool) bool {
+	// In memory rules don't have mock files
+	if r.InMemory {
+		return true
+	}
+
+	if !fsutil.IsExist(r.Path) {
+		obs.removeRule(snap, r)
+
+		log.Info("Rule %s unloaded (mock file deleted)", r.PrettyPath)
+
+		return true
+	}
+
+	mtime, _ := fsutil.GetMTime(r.Path)
+
+	if !force && r.ModTime.UnixNano() == mtime.UnixNano() && !r.isFilesChanged() {
+		return true
+	}
+
+	rule, err := Parse(obs.ruleDir, r.Service, r.Dir, r.Name)
+
+	if err == nil {
+		err = rule.LoadFiles()
+	}
+
+	if err != nil {
+		if obs.errMap[r.Path] != true {
+			log.Error("Can't reload rule %s: %v", r.PrettyPath, err)
+			obs.errMap[r.Path] = true
+		}
+
+		return false
+	}
+
+	// URI can be changed, remove rule from all maps anyway
+	obs.removeRule(snap, r)
+	obs.addRule(snap, rule)
+
+	log.Info("Rule %s reloaded", rule.PrettyPath)
+	logWarnings(rule)
+
+	return true
+}
+
+func (obs *Observer) checkRules(snap *snapshot, rules []string) bool {
 	var ok = true
 
-RULELOOP:
 	for _, rulePath := range rules {
 
 		service, mockFile, dir := ParsePath(rulePath)
@@ -210,7 +539,7 @@ RULELOOP:
 		fullPath := path.Join(obs.ruleDir, rulePath)
 		mockName := strings.Replace(mockFile, ".mock", "", -1)
 
-		if obs.pathMap[fullPath] != nil {
+		if snap.pathMap[fullPath] != nil {
 			continue
 		}
 
@@ -227,87 +556,256 @@ RULELOOP:
 			continue
 		}
 
-		for _, r := range obs.wcMap {
-			if r.Request.Method != rule.Request.Method {
-				continue
+		err = rule.LoadFiles()
+
+		if err != nil {
+
+			if obs.errMap[fullPath] != true {
+				log.Error("Can't load rule %s: %v", rule.PrettyPath, err)
+				obs.errMap[fullPath] = true
+				ok = false
 			}
 
-			if r.Request.Host != rule.Request.Host {
-				continue
+			continue
+		}
+
+		err = checkIntersection(snap, rule)
+
+		if err != nil {
+			if obs.errMap[rule.Path] != true {
+				log.Error(err.Error())
+				obs.errMap[rule.Path] = true
+				ok = false
 			}
 
-			if urlutil.EqualPatterns(r.Request.NURL, rule.Request.NURL) {
-				if obs.errMap[rule.Path] != true {
-					log.Error("Rule intersection: rule %s and rule %s have same result urls", r.PrettyPath, rule.PrettyPath)
-					obs.errMap[rule.Path] = true
-					ok = false
+			continue
+		}
+
+		obs.addRule(snap, rule)
+
+		log.Info("Rule %s loaded", rule.PrettyPath)
+		logWarnings(rule)
+	}
+
+	return ok
+}
+
+// addRule add rule to snapshot
+func (obs *Observer) addRule(snap *snapshot, rule *Rule) {
+	delete(obs.errMap, rule.Path)
+	snap.add(rule)
+}
+
+// logWarnings print warnings found while rule parsing
+func logWarnings(rule *Rule) {
+	for _, warning := range rule.Warnings {
+		log.Warn("Rule %s: %s - %s", rule.PrettyPath, warning.Location(), warning.Message)
+	}
+}
+
+// removeRule remove rule from snapshot
+func (obs *Observer) removeRule(snap *snapshot, rule *Rule) {
+	delete(obs.errMap, rule.Path)
+	snap.remove(rule)
+}
+
+func (obs *Observer) watch(checkDelay time.Duration, stop chan struct{}) {
+	for {
+		obs.Load()
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(checkDelay):
+		}
+	}
+}
+
+// listen reload rules on file system events
+func (obs *Observer) listen(w *watcher, checkDelay time.Duration, stop chan struct{}) {
+	obs.Load()
+
+	for event := range w.events {
+		events := []fsEvent{event}
+		timer := time.After(EVENTS_DELAY)
+
+		// Editors can save file in a few steps, so we collect all
+		// events for a short time and process them at once
+	COLLECTLOOP:
+		for {
+			select {
+			case e, ok := <-w.events:
+				if !ok {
+					break COLLECTLOOP
 				}
 
-				continue RULELOOP
+				events = append(events, e)
+
+			case <-timer:
+				break COLLECTLOOP
 			}
 		}
 
-		delete(obs.errMap, rule.Path)
+		obs.reload(events)
+	}
+
+	select {
+	case <-stop:
+		return
+	default:
+	}
+
+	log.Warn("Inotify watcher stopped, polling will be used instead")
 
-		obs.uriMap[rule.Request.URI] = rule
-		obs.pathMap[rule.Path] = rule
-		obs.srvMap[service] = true
+	obs.watch(checkDelay, stop)
+}
 
-		if rule.IsWildcard {
-			obs.wcMap[rule.Path] = rule
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// checkIntersection check rule for intersection with rules from snapshot
+func checkIntersection(snap *snapshot, rule *Rule) error {
+	for _, r := range snap.uriMap[rule.Request.URI] {
+		if isDuplicate(r, rule) {
+			return fmt.Errorf("Rule intersection: rule %s and rule %s have same request matchers", r.PrettyPath, rule.PrettyPath)
 		}
+	}
 
-		if obs.nameMap[service] == nil {
-			obs.nameMap[service] = make(RuleMap)
+	for _, r := range snap.wcList {
+		if isOverlap(r, rule) {
+			return fmt.Errorf("Rule intersection: rule %s and rule %s have same result urls", r.PrettyPath, rule.PrettyPath)
 		}
+	}
 
-		obs.nameMap[service][rule.FullName] = rule
+	return nil
+}
 
-		log.Info("Rule %s loaded", rule.PrettyPath)
+// sameState return true if rules require same scenario state
+func sameState(r1, r2 *Rule) bool {
+	if r1.RequiredState == "" || r2.RequiredState == "" {
+		return r1.RequiredState == r2.RequiredState
 	}
 
-	return ok
+	return r1.Scenario == r2.Scenario && r1.RequiredState == r2.RequiredState
 }
 
-func (obs *Observer) watch(checkDelay time.Duration) {
-	for {
-		obs.Load()
-		time.Sleep(checkDelay)
+// newSnapshot create new empty snapshot
+func newSnapshot() *snapshot {
+	return &snapshot{
+		uriMap:  make(RuleListMap),
+		pathMap: make(RuleMap),
+		nameMap: make(map[string]RuleMap),
+		srvMap:  make(map[string]bool),
+	}
+}
+
+// clone create copy of snapshot which can be safely modified
+func (s *snapshot) clone() *snapshot {
+	result := newSnapshot()
+
+	for uri, rules := range s.uriMap {
+		result.uriMap[uri] = rules
+	}
+
+	for path, rule := range s.pathMap {
+		result.pathMap[path] = rule
+	}
+
+	for service, rules := range s.nameMap {
+		result.nameMap[service] = make(RuleMap)
+
+		for name, rule := range rules {
+			result.nameMap[service][name] = rule
+		}
+	}
+
+	for service := range s.srvMap {
+		result.srvMap[service] = true
+	}
+
+	// Rules lists never modified in place, so we can share them
+	result.wcList = s.wcList
+
+	return result
+}
+
+// add add rule to all snapshot maps
+func (s *snapshot) add(rule *Rule) {
+	s.uriMap[rule.Request.URI] = s.uriMap[rule.Request.URI].insert(rule)
+	s.pathMap[rule.Path] = rule
+	s.srvMap[rule.Service] = true
+
+	if rule.IsWildcard {
+		s.wcList = s.wcList.insert(rule)
+	}
+
+	if s.nameMap[rule.Service] == nil {
+		s.nameMap[rule.Service] = make(RuleMap)
+	}
+
+	s.nameMap[rule.Service][rule.FullName] = rule
+}
+
+// remove remove rule from all snapshot maps
+func (s *snapshot) remove(rule *Rule) {
+	s.uriMap[rule.Request.URI] = s.uriMap[rule.Request.URI].exclude(rule)
+
+	if len(s.uriMap[rule.Request.URI]) == 0 {
+		delete(s.uriMap, rule.Request.URI)
+	}
+
+	s.wcList = s.wcList.exclude(rule)
+
+	delete(s.pathMap, rule.Path)
+	delete(s.nameMap[rule.Service], rule.FullName)
+
+	// If no one rule found for service, remove it's own map
+	if len(s.nameMap[rule.Service]) == 0 {
+		delete(s.nameMap, rule.Service)
+		delete(s.srvMap, rule.Service)
 	}
 }
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
-func findRule(uriMap, wcMap RuleMap, r *http.Request, autoHead bool) *Rule {
+func findRule(uriMap RuleListMap, wcList RuleList, states *scenarioStates, r *http.Request, body []byte, autoHead bool) *Rule {
 	var result *Rule
 
 	host := httputil.GetRequestHost(r)
 	uri := urlutil.SortURLParams(r.URL)
 
-	log.Debug("Rules statistics: URI: %d | WC: %d", len(uriMap), len(wcMap))
+	log.Debug("Rules statistics: URI: %d | WC: %d", len(uriMap), len(wcList))
 	log.Debug("Searching rule for %s → %s%s (autohead=%t)", r.Method, host, uri, autoHead)
 
-	result = getRule(uriMap, host, r.Method, uri)
+	result = findExactRule(uriMap, states, r, body, host, uri, autoHead, false)
 
 	if result != nil {
 		return result
 	}
 
-	if autoHead {
-		for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
-			result = getRule(uriMap, host, method, uri)
+	result = findWildcardRule(wcList, states, r, body, host, uri, autoHead, false)
 
-			if result != nil {
-				return result
-			}
-		}
+	if result != nil || !strings.Contains(uri, "?") {
+		return result
 	}
 
-	if len(wcMap) == 0 {
-		return nil
+	// Rule without query in URL but with conditions for query params
+	// matches request with any query string
+	path := uri[:strings.Index(uri, "?")]
+
+	result = findExactRule(uriMap, states, r, body, host, path, autoHead, true)
+
+	if result != nil {
+		return result
 	}
 
-	for _, rule := range wcMap {
+	return findWildcardRule(wcList, states, r, body, host, path, autoHead, true)
+}
+
+// findWildcardRule find first wildcard rule which matches given URI (if
+// queryConds is true only rules with conditions for query params are checked)
+func findWildcardRule(wcList RuleList, states *scenarioStates, r *http.Request, body []byte, host, uri string, autoHead, queryConds bool) *Rule {
+	// Wildcard rules sorted by priority, so first matched rule is the best one
+	for _, rule := range wcList {
 		if !autoHead && rule.Request.Method != r.Method {
 			continue
 		}
@@ -316,8 +814,16 @@ func findRule(uriMap, wcMap RuleMap, r *http.Request, autoHead bool) *Rule {
 			continue
 		}
 
+		if queryConds && !rule.hasQueryConditions() {
+			continue
+		}
+
+		if !rule.Request.Match(r, body) || !states.isFit(rule) {
+			continue
+		}
+
 		// For matching we use normalized url (with sorted get params)
-		if urlutil.Match(rule.Request.NURL, uri) {
+		if rule.Request.MatchURL(uri) {
 			return rule
 		}
 	}
@@ -325,16 +831,137 @@ func findRule(uriMap, wcMap RuleMap, r *http.Request, autoHead bool) *Rule {
 	return nil
 }
 
-func getRule(ruleMap RuleMap, host, method, uri string) *Rule {
+// findExactRule find rule with exactly the same URI (if queryConds is true
+// only rules with conditions for query params are checked)
+func findExactRule(uriMap RuleListMap, states *scenarioStates, r *http.Request, body []byte, host, uri string, autoHead, queryConds bool) *Rule {
+	result := getRule(uriMap, states, r, body, host, r.Method, uri, queryConds)
+
+	if result != nil || !autoHead {
+		return result
+	}
+
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+		result = getRule(uriMap, states, r, body, host, method, uri, queryConds)
+
+		if result != nil {
+			return result
+		}
+	}
+
+	return nil
+}
+
+func getRule(ruleMap RuleListMap, states *scenarioStates, r *http.Request, body []byte, host, method, uri string, queryConds bool) *Rule {
 	var result *Rule
 
-	result = ruleMap[host+":"+method+":"+uri]
+	result = selectRule(ruleMap[host+":"+method+":"+uri], states, r, body, queryConds)
 
 	if result != nil {
 		return result
 	}
 
-	result = ruleMap[":"+method+":"+uri]
+	result = selectRule(ruleMap[":"+method+":"+uri], states, r, body, queryConds)
+
+	return result
+}
+
+// selectRule return first rule which request matchers and required scenario
+// state fits given request
+func selectRule(rules RuleList, states *scenarioStates, r *http.Request, body []byte, queryConds bool) *Rule {
+	for _, rule := range rules {
+		if queryConds && !rule.hasQueryConditions() {
+			continue
+		}
+
+		if rule.Request.Match(r, body) && states.isFit(rule) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// compareRules compare rules priority and return -1 if r1 must be checked before
+// r2, 1 if r2 must be checked before r1 and 0 if rules have same priority
+func compareRules(r1, r2 *Rule) int {
+	if r1.Priority != r2.Priority {
+		return compareInts(r2.Priority, r1.Priority)
+	}
+
+	// Rule with longer literal prefix is more specific
+	p1 := len(urlutil.LiteralPrefix(r1.Request.NURL))
+	p2 := len(urlutil.LiteralPrefix(r2.Request.NURL))
+
+	if p1 != p2 {
+		return compareInts(p2, p1)
+	}
+
+	// Rule with fewer wildcards is more specific
+	w1 := urlutil.WildcardsNum(r1.Request.NURL)
+	w2 := urlutil.WildcardsNum(r2.Request.NURL)
+
+	if w1 != w2 {
+		return compareInts(w1, w2)
+	}
+
+	// Rule with more request matchers is more specific
+	m1 := r1.Request.MatchersNum()
+	m2 := r2.Request.MatchersNum()
+
+	if m1 != m2 {
+		return compareInts(m2, m1)
+	}
+
+	// Rule with required scenario state is more specific
+	return compareInts(len(r2.RequiredState), len(r1.RequiredState))
+}
+
+// compareInts compare two ints and return -1, 0 or 1
+func compareInts(i1, i2 int) int {
+	switch {
+	case i1 < i2:
+		return -1
+	case i1 > i2:
+		return 1
+	}
+
+	return 0
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// insert return new list with given rule, list is sorted by priority and
+// rules with same priority sorted by path
+func (l RuleList) insert(rule *Rule) RuleList {
+	var index int
+
+	for index = 0; index < len(l); index++ {
+		result := compareRules(rule, l[index])
+
+		if result < 0 || (result == 0 && rule.Path < l[index].Path) {
+			break
+		}
+	}
+
+	// List can be used by another snapshot, so we always create new one
+	result := make(RuleList, len(l)+1)
+
+	copy(result, l[:index])
+	copy(result[index+1:], l[index:])
+	result[index] = rule
+
+	return result
+}
+
+// exclude return list without given rule
+func (l RuleList) exclude(rule *Rule) RuleList {
+	var result RuleList
+
+	for _, r := range l {
+		if r.Path != rule.Path {
+			result = append(result, r)
+		}
+	}
 
 	return result
 }
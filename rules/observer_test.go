@@ -0,0 +1,311 @@
+package rules
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+type ObserverSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&ObserverSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *ObserverSuite) TestLoading(c *C) {
+	observer := NewObserver("../common/testdata")
+
+	c.Assert(observer.GetServices(), HasLen, 0)
+
+	observer.Load()
+
+	c.Assert(observer.GetServices(), DeepEquals, []string{"test1"})
+	c.Assert(observer.GetServiceRulesNames("test1"), DeepEquals, []string{"dir1/test"})
+	c.Assert(observer.GetServiceRulesNames("unknown"), HasLen, 0)
+	c.Assert(observer.GetRuleByName("test1", "dir1/test"), Not(IsNil))
+	c.Assert(observer.GetRuleByName("unknown", "dir1/test"), IsNil)
+
+	r, _ := http.NewRequest("GET", "http://test.domain/test?id=123&action=delete&user=bob", nil)
+
+	c.Assert(observer.GetRule(r, nil), Not(IsNil))
+	c.Assert(observer.GetRule(r, nil).FullName, Equals, "dir1/test")
+}
+
+func (s *ObserverSuite) TestConcurrentAccess(c *C) {
+	observer := NewObserver("../common/testdata")
+	observer.Load()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				r, _ := http.NewRequest("GET", "http://test.domain/test?id=123&action=delete&user=bob", nil)
+
+				if observer.GetRule(r, nil) == nil {
+					c.Error("Rule not found")
+				}
+
+				observer.GetServices()
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		// Force reloading of all rules
+		snap := observer.getSnapshot().clone()
+
+		for _, rule := range snap.pathMap {
+			reloaded := *rule
+			reloaded.ModTime = rule.ModTime.Add(-1)
+			snap.remove(rule)
+			snap.add(&reloaded)
+		}
+
+		observer.current.Store(snap)
+		observer.Load()
+	}
+
+	wg.Wait()
+}
+
+func (s *ObserverSuite) TestInotifyReloading(c *C) {
+	if runtime.GOOS != "linux" {
+		c.Skip("Inotify is not supported on this platform")
+	}
+
+	ruleDir := c.MkDir()
+	serviceDir := ruleDir + "/service"
+
+	c.Assert(os.Mkdir(serviceDir, 0755), IsNil)
+	c.Assert(writeMock(serviceDir+"/test.mock", "/test1"), IsNil)
+
+	observer := NewObserver(ruleDir)
+	observer.UseInotify = true
+	observer.Start(3600)
+
+	c.Assert(waitRule(observer, "/test1", true), Equals, true)
+
+	c.Assert(writeMock(serviceDir+"/test.mock", "/test2"), IsNil)
+
+	c.Assert(waitRule(observer, "/test2", true), Equals, true)
+	c.Assert(waitRule(observer, "/test1", false), Equals, true)
+
+	c.Assert(os.Mkdir(serviceDir+"/dir1", 0755), IsNil)
+	c.Assert(writeMock(serviceDir+"/dir1/test.mock", "/test3"), IsNil)
+
+	c.Assert(waitRule(observer, "/test3", true), Equals, true)
+
+	c.Assert(os.Remove(serviceDir+"/test.mock"), IsNil)
+
+	c.Assert(waitRule(observer, "/test2", false), Equals, true)
+
+	w := observer.watcher
+	observer.Stop()
+
+	c.Assert(observer.watcher, IsNil)
+
+	// Events channel is closed after inotify instance closing
+	_, ok := <-w.events
+
+	c.Assert(ok, Equals, false)
+}
+
+func (s *ObserverSuite) TestInotifyExternalFiles(c *C) {
+	if runtime.GOOS != "linux" {
+		c.Skip("Inotify is not supported on this platform")
+	}
+
+	baseDir := c.MkDir()
+	ruleDir := baseDir + "/rules"
+	sharedDir := baseDir + "/shared"
+	mockData := "@REQUEST\nGET /test\n\n@RESPONSE < ../../shared/data.json\n"
+
+	c.Assert(os.MkdirAll(ruleDir+"/service", 0755), IsNil)
+	c.Assert(os.Mkdir(sharedDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(sharedDir+"/data.json", []byte("ABCD"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(ruleDir+"/service/test.mock", []byte(mockData), 0644), IsNil)
+
+	observer := NewObserver(ruleDir)
+	observer.UseInotify = true
+	observer.Start(3600)
+
+	defer observer.Stop()
+
+	c.Assert(waitRule(observer, "/test", true), Equals, true)
+	c.Assert(observer.GetRuleByName("service", "test").Responses[DEFAULT].Body(), Equals, "ABCD")
+
+	c.Assert(ioutil.WriteFile(sharedDir+"/data.json", []byte("1234"), 0644), IsNil)
+
+	var body string
+
+	for i := 0; i < 50; i++ {
+		body = observer.GetRuleByName("service", "test").Responses[DEFAULT].Body()
+
+		if body == "1234" {
+			break
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	c.Assert(body, Equals, "1234")
+}
+
+func (s *ObserverSuite) TestResponseFilesReloading(c *C) {
+	ruleDir := c.MkDir()
+	serviceDir := ruleDir + "/service"
+	mockData := "@REQUEST\nGET /test\n\n@RESPONSE < data.json\n"
+
+	c.Assert(os.Mkdir(serviceDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(serviceDir+"/test.mock", []byte(mockData), 0644), IsNil)
+
+	observer := NewObserver(ruleDir)
+
+	c.Assert(observer.Load(), Equals, false)
+	c.Assert(observer.GetRuleByName("service", "test"), IsNil)
+
+	c.Assert(ioutil.WriteFile(serviceDir+"/data.json", []byte("ABCD"), 0644), IsNil)
+
+	c.Assert(observer.Load(), Equals, true)
+
+	rule := observer.GetRuleByName("service", "test")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(rule.Files, HasLen, 1)
+	c.Assert(rule.Responses[DEFAULT].Body(), Equals, "ABCD")
+
+	c.Assert(ioutil.WriteFile(serviceDir+"/data.json", []byte("1234"), 0644), IsNil)
+	c.Assert(os.Chtimes(serviceDir+"/data.json", time.Now(), time.Now().Add(time.Hour)), IsNil)
+
+	// Content is cached until rules reloading
+	c.Assert(rule.Responses[DEFAULT].Body(), Equals, "ABCD")
+
+	c.Assert(observer.Load(), Equals, true)
+	c.Assert(observer.GetRuleByName("service", "test").Responses[DEFAULT].Body(), Equals, "1234")
+
+	c.Assert(os.Remove(serviceDir+"/data.json"), IsNil)
+
+	c.Assert(observer.Load(), Equals, false)
+}
+
+func (s *ObserverSuite) TestRuntimeRules(c *C) {
+	observer := NewObserver("../common/testdata")
+	observer.Load()
+
+	rule, err := ParseContent([]byte("@REQUEST\nGET /runtime\n\n@RESPONSE\nTest\n"), "../common/testdata", "test1", "", "runtime")
+
+	c.Assert(err, IsNil)
+	c.Assert(observer.CheckRule(rule), IsNil)
+	c.Assert(observer.AddRule(rule), IsNil)
+	c.Assert(waitRule(observer, "/runtime", true), Equals, true)
+	c.Assert(observer.GetRuleByName("test1", "runtime").InMemory, Equals, true)
+
+	// Loading must not unload rules without mock files
+	observer.Load()
+
+	c.Assert(observer.GetRuleByName("test1", "runtime"), Not(IsNil))
+
+	rule, err = ParseContent([]byte("@HOST\ntest.domain\n@REQUEST\nGET /test?user=bob&id=123&action=delete\n"), "../common/testdata", "test1", "", "conflict")
+
+	c.Assert(err, IsNil)
+	c.Assert(observer.CheckRule(rule), NotNil)
+	c.Assert(observer.AddRule(rule), NotNil)
+
+	c.Assert(observer.RemoveRule("test1", "runtime"), Equals, true)
+	c.Assert(observer.RemoveRule("test1", "runtime"), Equals, false)
+	c.Assert(observer.GetRuleByName("test1", "runtime"), IsNil)
+
+	_, err = ParseContent([]byte("  \n"), "../common/testdata", "test1", "", "empty")
+
+	c.Assert(err, NotNil)
+}
+
+func (s *ObserverSuite) TestScenarios(c *C) {
+	observer := NewObserver("")
+
+	mocks := map[string]string{
+		"pending": "@SCENARIO\ncheckout\n@REQUIRED-STATE\nstarted\n@REQUEST\nGET /order\n",
+		"confirm": "@SCENARIO\ncheckout\n@NEW-STATE\npaid\n@REQUEST\nPOST /confirm\n",
+		"done":    "@SCENARIO\ncheckout\n@REQUIRED-STATE\npaid\n@REQUEST\nGET /order\n",
+	}
+
+	for name, data := range mocks {
+		rule, err := ParseContent([]byte(data), "", "test", "", name)
+
+		c.Assert(err, IsNil)
+		c.Assert(observer.AddRule(rule), IsNil)
+	}
+
+	getOrder, _ := http.NewRequest("GET", "http://127.0.0.1/order", nil)
+	confirm, _ := http.NewRequest("POST", "http://127.0.0.1/confirm", nil)
+
+	c.Assert(observer.GetRule(getOrder, nil).Name, Equals, "pending")
+	c.Assert(observer.GetRule(getOrder, nil).Name, Equals, "pending")
+	c.Assert(observer.GetRule(confirm, nil).Name, Equals, "confirm")
+
+	// State isn't changed until response is sent
+	c.Assert(observer.GetRule(getOrder, nil).Name, Equals, "pending")
+
+	observer.ApplyNewState(observer.GetRule(confirm, nil))
+	observer.ApplyNewState(observer.GetRule(getOrder, nil))
+
+	c.Assert(observer.GetRule(getOrder, nil).Name, Equals, "done")
+	c.Assert(observer.GetScenarios(), DeepEquals, map[string]string{"checkout": "paid"})
+
+	observer.ResetScenarios()
+
+	c.Assert(observer.GetRule(getOrder, nil).Name, Equals, "pending")
+
+	observer.SetScenarioState("checkout", "unknown")
+
+	c.Assert(observer.GetRule(getOrder, nil), IsNil)
+
+	observer.ResetScenarios("checkout")
+
+	c.Assert(observer.GetRule(getOrder, nil).Name, Equals, "pending")
+
+	rule, _ := ParseContent([]byte(mocks["done"]), "", "test", "", "done2")
+
+	c.Assert(observer.AddRule(rule), NotNil)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func writeMock(file, url string) error {
+	return ioutil.WriteFile(file, []byte("@REQUEST\nGET "+url+"\n\n@RESPONSE\nTest\n"), 0644)
+}
+
+func waitRule(observer *Observer, url string, exist bool) bool {
+	r, _ := http.NewRequest("GET", "http://127.0.0.1"+url, nil)
+
+	for i := 0; i < 50; i++ {
+		if (observer.GetRule(r, nil) != nil) == exist {
+			return true
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return false
+}
@@ -9,7 +9,9 @@ package rules
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
@@ -24,6 +26,23 @@ import (
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
+// ruleLine is line from mock file
+type ruleLine struct {
+	Num  int    // Line number
+	Text string // Line content
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// knownSections contains names of all supported sections
+var knownSections = map[string]bool{
+	"DESCRIPTION": true, "HOST": true, "REQUEST": true, "MATCH-BODY": true,
+	"MATCH-HEADERS": true, "MATCH-COOKIES": true, "RESPONSE": true, "CODE": true,
+	"HEADERS": true, "DELAY": true, "PRIORITY": true, "MODE": true, "SEED": true,
+	"WEIGHT": true, "WHEN": true, "SCENARIO": true, "REQUIRED-STATE": true,
+	"NEW-STATE": true, "AUTH": true,
+}
+
 // contentTypes contains map file ext -> content type
 var contentTypes = map[string]string{
 	".json": "text/javascript",
@@ -50,26 +69,16 @@ func Parse(ruleDir, service, dir, mock string) (*Rule, error) {
 
 	defer fd.Close()
 
-	reader := bufio.NewReader(fd)
-	scanner := bufio.NewScanner(reader)
-
-	var data []string
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if line == "" || strings.Replace(line, " ", "", -1) == "" {
-			continue
-		}
-
-		if strings.HasPrefix(strings.Trim(line, " "), "#") {
-			continue
-		}
+	return parseRuleData(readRuleData(fd), ruleDir, service, dir, mock)
+}
 
-		data = append(data, line)
+// ParseContent parse rule from mock file content
+func ParseContent(content []byte, ruleDir, service, dir, mock string) (*Rule, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, fmt.Errorf("Mock %s content is empty", path.Join(service, dir, mock))
 	}
 
-	return parseRuleData(data, ruleDir, service, dir, mock)
+	return parseRuleData(readRuleData(bytes.NewReader(content)), ruleDir, service, dir, mock)
 }
 
 // ParsePath parse path of rule file and return service name,
@@ -90,7 +99,7 @@ func ParsePath(path string) (string, string, string) {
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
-func parseRuleData(data []string, ruleDir, service, dir, mock string) (*Rule, error) {
+func parseRuleData(data []*ruleLine, ruleDir, service, dir, mock string) (*Rule, error) {
 	var rule = NewRule()
 
 	rule.Dir = dir
@@ -103,10 +112,24 @@ func parseRuleData(data []string, ruleDir, service, dir, mock string) (*Rule, er
 
 	var section, id, source string
 	var overwrite bool
+	var header, bodyHeader, stateLine, whenHeader *ruleLine
+
+	for _, ruleLine := range data {
+		line := ruleLine.Text
 
-	for _, line := range data {
 		if line[0:1] == "@" {
 			section, id, source, overwrite = parseSectionHeader(line)
+			header = ruleLine
+
+			if rule.SectionLine(section, id) == 0 {
+				rule.Sections[getSectionKey(section, id)] = ruleLine.Num
+			}
+
+			if !knownSections[section] {
+				rule.Warnings = append(rule.Warnings,
+					newParseError(rule.Path, ruleLine, "", "unknown section %s", section),
+				)
+			}
 
 			if section == "RESPONSE" && source != "" {
 				resp := getResponse(rule, id)
@@ -125,6 +148,21 @@ func parseRuleData(data []string, ruleDir, service, dir, mock string) (*Rule, er
 				}
 			}
 
+			if section == "MATCH-BODY" {
+				if rule.Request.Body != nil {
+					return nil, newParseError(rule.Path, ruleLine, "", "section MATCH-BODY is already defined on line %d", bodyHeader.Num)
+				}
+
+				matchType, err := getMatchType(id)
+
+				if err != nil {
+					return nil, newParseError(rule.Path, ruleLine, "", "section MATCH-BODY is malformed: %v", err)
+				}
+
+				rule.Request.Body = &BodyMatcher{Type: matchType}
+				bodyHeader = ruleLine
+			}
+
 			continue
 		}
 
@@ -139,11 +177,25 @@ func parseRuleData(data []string, ruleDir, service, dir, mock string) (*Rule, er
 			reqMethod, reqURL := parseRequestInfo(line)
 
 			if reqMethod == "" || reqURL == "" {
-				return nil, fmt.Errorf("Can't parse file %s - section REQUEST is malformed", rule.Path)
+				return nil, newParseError(rule.Path, ruleLine, "", "section REQUEST is malformed")
+			}
+
+			if urlutil.IsRegexp(reqURL) {
+				re, err := urlutil.Compile(reqURL)
+
+				if err != nil {
+					return nil, newParseError(rule.Path, ruleLine, reqURL, "can't parse regexp in REQUEST section: %v", err)
+				}
+
+				rule.IsWildcard = true
+				rule.Request.re = re
+				rule.Request.Method, rule.Request.URL = reqMethod, reqURL
+
+				continue
 			}
 
 			if reqURL[0:1] != "/" {
-				return nil, fmt.Errorf("Can't parse file %s - request url must start from /", rule.Path)
+				return nil, newParseError(rule.Path, ruleLine, reqURL, "request url must start from /")
 			}
 
 			if strings.Contains(reqURL, "*") {
@@ -152,20 +204,49 @@ func parseRuleData(data []string, ruleDir, service, dir, mock string) (*Rule, er
 				if err == nil {
 					rule.IsWildcard = strings.Contains(reqURL, "*")
 				} else {
-					return nil, fmt.Errorf("Can't parse file %s - can't parse query in REQUEST section", rule.Path)
+					return nil, newParseError(rule.Path, ruleLine, reqURL, "can't parse query in REQUEST section")
 				}
 			}
 
+			if urlutil.HasParams(reqURL) {
+				re, err := urlutil.Compile(reqURL)
+
+				if err != nil {
+					return nil, newParseError(rule.Path, ruleLine, reqURL, "can't parse named params in REQUEST section: %v", err)
+				}
+
+				rule.IsWildcard = true
+				rule.Request.re = re
+			}
+
 			rule.Request.Method, rule.Request.URL = reqMethod, reqURL
 
+		case "MATCH-BODY":
+			rule.Request.Body.Content += line + "\n"
+
+		case "MATCH-HEADERS", "MATCH-COOKIES":
+			matcher, err := parseValueMatcher(line)
+
+			if err != nil {
+				return nil, newParseError(rule.Path, ruleLine, "", "section %s is malformed: %v", section, err)
+			}
+
+			if section == "MATCH-HEADERS" {
+				rule.Request.Headers = append(rule.Request.Headers, matcher)
+			} else {
+				rule.Request.Cookies = append(rule.Request.Cookies, matcher)
+			}
+
 		case "RESPONSE":
-			getResponse(rule, id).Content += line + "\n"
+			resp := getResponse(rule, id)
+			resp.Content += line + "\n"
+			resp.lines = append(resp.lines, ruleLine.Num)
 
 		case "CODE":
 			code, err := strconv.Atoi(strings.TrimRight(line, " "))
 
 			if err != nil {
-				return nil, fmt.Errorf("Can't parse file %s - section CODE is malformed", rule.Path)
+				return nil, newParseError(rule.Path, ruleLine, "", "section CODE is malformed")
 			}
 
 			getResponse(rule, id).Code = code
@@ -174,7 +255,7 @@ func parseRuleData(data []string, ruleDir, service, dir, mock string) (*Rule, er
 			headerName, headerValue := parseHTTPHeader(line)
 
 			if headerName == "" || headerValue == "" {
-				return nil, fmt.Errorf("Can't parse file %s - section HEADERS is malformed", rule.Path)
+				return nil, newParseError(rule.Path, ruleLine, "", "section HEADERS is malformed")
 			}
 
 			getResponse(rule, id).Headers[headerName] = headerValue
@@ -183,16 +264,81 @@ func parseRuleData(data []string, ruleDir, service, dir, mock string) (*Rule, er
 			delay, err := strconv.ParseFloat(strings.TrimRight(line, " "), 64)
 
 			if err != nil {
-				return nil, fmt.Errorf("Can't parse file %s - section DELAY is malformed", rule.Path)
+				return nil, newParseError(rule.Path, ruleLine, "", "section DELAY is malformed")
 			}
 
 			getResponse(rule, id).Delay = delay
 
+		case "PRIORITY":
+			priority, err := strconv.Atoi(strings.TrimRight(line, " "))
+
+			if err != nil {
+				return nil, newParseError(rule.Path, ruleLine, "", "section PRIORITY is malformed")
+			}
+
+			rule.Priority = priority
+
+		case "MODE":
+			rule.Mode = strings.ToLower(strings.TrimSpace(line))
+
+			switch rule.Mode {
+			case MODE_RANDOM, MODE_SEQUENTIAL, MODE_ROUND_ROBIN, MODE_WEIGHTED:
+			default:
+				return nil, newParseError(rule.Path, ruleLine, "", "section MODE is malformed")
+			}
+
+		case "SEED":
+			seed, err := parseSeed(line)
+
+			if err != nil {
+				return nil, newParseError(rule.Path, ruleLine, "", "section SEED is malformed: %v", err)
+			}
+
+			rule.Seed = seed
+
+		case "WEIGHT":
+			weight, err := strconv.Atoi(strings.TrimSpace(line))
+
+			if err != nil || weight <= 0 {
+				return nil, newParseError(rule.Path, ruleLine, "", "section WEIGHT is malformed")
+			}
+
+			getResponse(rule, id).Weight = weight
+
+		case "WHEN":
+			if id == DEFAULT {
+				return nil, newParseError(rule.Path, header, "", "section WHEN must have response id")
+			}
+
+			condition, err := parseCondition(line)
+
+			if err != nil {
+				return nil, newParseError(rule.Path, ruleLine, "", "section WHEN is malformed: %v", err)
+			}
+
+			if whenHeader == nil {
+				whenHeader = header
+			}
+
+			resp := getResponse(rule, id)
+			resp.When = append(resp.When, condition)
+
+		case "SCENARIO":
+			rule.Scenario = strings.TrimSpace(line)
+
+		case "REQUIRED-STATE":
+			rule.RequiredState = strings.TrimSpace(line)
+			stateLine = ruleLine
+
+		case "NEW-STATE":
+			rule.NewState = strings.TrimSpace(line)
+			stateLine = ruleLine
+
 		case "AUTH":
 			lpa := strings.Split(strings.TrimRight(line, " "), ":")
 
 			if len(lpa) != 2 {
-				return nil, fmt.Errorf("Can't parse file %s - section AUTH is malformed", rule.Path)
+				return nil, newParseError(rule.Path, ruleLine, "", "section AUTH is malformed")
 			}
 
 			rule.Auth.User, rule.Auth.Password = lpa[0], lpa[1]
@@ -204,7 +350,41 @@ func parseRuleData(data []string, ruleDir, service, dir, mock string) (*Rule, er
 		rule.Responses[DEFAULT] = &Response{Headers: make(map[string]string)}
 	}
 
-	rule.Request.NURL = urlutil.SortParams(rule.Request.URL)
+	if whenHeader != nil && !rule.hasUnconditionalResponse() {
+		return nil, newParseError(rule.Path, whenHeader, "", "rule with conditional responses must have response without conditions")
+	}
+
+	if rule.Scenario == "" && (rule.RequiredState != "" || rule.NewState != "") {
+		return nil, newParseError(rule.Path, stateLine, "", "section SCENARIO is required for using scenario states")
+	}
+
+	if rule.Request.Body != nil {
+		err := rule.Request.Body.compile()
+
+		if err != nil {
+			return nil, newParseError(rule.Path, bodyHeader, "", "section MATCH-BODY is malformed: %v", err)
+		}
+	}
+
+	for _, id := range append(rule.getResponsesIDs(), DEFAULT) {
+		resp := rule.Responses[id]
+
+		if resp == nil || resp.File != "" || resp.URL != "" {
+			continue
+		}
+
+		err := resp.compile()
+
+		if err != nil {
+			return nil, newTemplateParseError(rule.Path, data, resp.TemplateError(err))
+		}
+	}
+
+	if urlutil.IsRegexp(rule.Request.URL) {
+		rule.Request.NURL = rule.Request.URL
+	} else {
+		rule.Request.NURL = urlutil.SortParams(rule.Request.URL)
+	}
 	rule.Request.URI = rule.Request.Host + ":" + rule.Request.Method + ":" + rule.Request.NURL
 
 	mtime, _ := fsutil.GetMTime(rule.Path)
@@ -213,6 +393,33 @@ func parseRuleData(data []string, ruleDir, service, dir, mock string) (*Rule, er
 	return rule, nil
 }
 
+// readRuleData read mock data and return all lines except empty lines
+// and comments
+func readRuleData(r io.Reader) []*ruleLine {
+	reader := bufio.NewReader(r)
+	scanner := bufio.NewScanner(reader)
+
+	var data []*ruleLine
+	var num int
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		num++
+
+		if line == "" || strings.Replace(line, " ", "", -1) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(strings.Trim(line, " "), "#") {
+			continue
+		}
+
+		data = append(data, &ruleLine{num, line})
+	}
+
+	return data
+}
+
 func checkMockFile(file string) error {
 	switch {
 	case fsutil.IsExist(file) == false:
@@ -265,7 +472,7 @@ func parseRequestInfo(request string) (string, string) {
 }
 
 func parseHTTPHeader(header string) (string, string) {
-	headerSlice := strings.Split(header, ":")
+	headerSlice := strings.SplitN(header, ":", 2)
 
 	if len(headerSlice) < 2 {
 		return "", ""
@@ -274,6 +481,19 @@ func parseHTTPHeader(header string) (string, string) {
 	return strings.TrimRight(headerSlice[0], " "), strings.TrimLeft(headerSlice[1], " ")
 }
 
+func getMatchType(id string) (string, error) {
+	switch strings.ToLower(id) {
+	case DEFAULT:
+		return MATCH_EXACT, nil
+	case "regexp":
+		return MATCH_REGEX, nil
+	case MATCH_EXACT, MATCH_CONTAINS, MATCH_REGEX, MATCH_JSON:
+		return strings.ToLower(id), nil
+	}
+
+	return "", fmt.Errorf("unknown matching type %s", id)
+}
+
 func getResponse(rule *Rule, id string) *Response {
 	resp, ok := rule.Responses[id]
 
@@ -297,3 +517,53 @@ func guessContentType(file string) string {
 
 	return "text/plain"
 }
+
+// newParseError create error for given line of mock file, column points
+// to given text or to first non-space symbol of line
+func newParseError(file string, line *ruleLine, text, format string, args ...interface{}) *ParseError {
+	result := &ParseError{File: file, Message: fmt.Sprintf(format, args...)}
+
+	if line == nil {
+		return result
+	}
+
+	result.Line = line.Num
+
+	if text == "" {
+		text = strings.TrimSpace(line.Text)
+	}
+
+	result.Text = text
+
+	if index := strings.Index(line.Text, text); index != -1 {
+		result.Column = index + 1
+	}
+
+	return result
+}
+
+// newTemplateParseError create error for response template error with
+// position in mock file
+func newTemplateParseError(file string, data []*ruleLine, err error) *ParseError {
+	posErr, ok := err.(*PositionError)
+
+	if !ok {
+		return &ParseError{File: file, Message: "template in section RESPONSE is malformed: " + err.Error()}
+	}
+
+	result := &ParseError{
+		File:    file,
+		Line:    posErr.Line,
+		Column:  posErr.Column,
+		Message: "template in section RESPONSE is malformed: " + posErr.Message,
+	}
+
+	for _, line := range data {
+		if line.Num == posErr.Line {
+			result.Text = strings.TrimSpace(line.Text)
+			break
+		}
+	}
+
+	return result
+}
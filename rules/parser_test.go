@@ -8,6 +8,9 @@ package rules
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 import (
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"testing"
 
 	. "pkg.re/check.v1"
@@ -43,32 +46,97 @@ func (s *ParseSuite) TestParsingError(c *C) {
 	_, err = Parse("../common/testdata", "", "", "error_resp1")
 
 	c.Assert(err, Not(IsNil))
-	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_resp1.mock - section REQUEST is malformed")
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_resp1.mock:5:1 - section REQUEST is malformed (\"GET\")")
 
 	_, err = Parse("../common/testdata", "", "", "error_resp2")
 
 	c.Assert(err, Not(IsNil))
-	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_resp2.mock - request url must start from /")
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_resp2.mock:5:5 - request url must start from / (\"test\")")
 
 	_, err = Parse("../common/testdata", "", "", "error_code")
 
 	c.Assert(err, Not(IsNil))
-	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_code.mock - section CODE is malformed")
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_code.mock:8:1 - section CODE is malformed (\"ABC\")")
 
 	_, err = Parse("../common/testdata", "", "", "error_headers")
 
 	c.Assert(err, Not(IsNil))
-	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_headers.mock - section HEADERS is malformed")
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_headers.mock:8:1 - section HEADERS is malformed (\"test 123\")")
 
 	_, err = Parse("../common/testdata", "", "", "error_delay")
 
 	c.Assert(err, Not(IsNil))
-	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_delay.mock - section DELAY is malformed")
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_delay.mock:8:1 - section DELAY is malformed (\"test\")")
 
 	_, err = Parse("../common/testdata", "", "", "error_auth")
 
 	c.Assert(err, Not(IsNil))
-	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_auth.mock - section AUTH is malformed")
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_auth.mock:8:1 - section AUTH is malformed (\"test\")")
+
+	_, err = Parse("../common/testdata", "", "", "error_params")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Matches, "Can't parse file ../common/testdata/error_params.mock:5:5 - can't parse named params in REQUEST section: .*")
+
+	_, err = Parse("../common/testdata", "", "", "error_regexp")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Matches, "Can't parse file ../common/testdata/error_regexp.mock:5:5 - can't parse regexp in REQUEST section: .*")
+
+	_, err = Parse("../common/testdata", "", "", "error_priority")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_priority.mock:5:1 - section PRIORITY is malformed (\"high\")")
+
+	_, err = Parse("../common/testdata", "", "", "error_mode")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_mode.mock:5:1 - section MODE is malformed (\"sometimes\")")
+
+	_, err = Parse("../common/testdata", "", "", "error_weight")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_weight.mock:8:1 - section WEIGHT is malformed (\"-5\")")
+
+	_, err = Parse("../common/testdata", "", "", "error_when")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_when.mock:8:1 - section WHEN is malformed: unknown condition source form (\"form:name=value\")")
+
+	_, err = Parse("../common/testdata", "", "", "error_when_default")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_when_default.mock:7:1 - rule with conditional responses must have response without conditions (\"@WHEN:1\")")
+
+	_, err = Parse("../common/testdata", "", "", "error_seed")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_seed.mock:8:1 - section SEED is malformed: unknown seed source form (\"form:id\")")
+
+	_, err = Parse("../common/testdata", "", "", "error_scenario")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_scenario.mock:5:1 - section SCENARIO is required for using scenario states (\"paid\")")
+
+	_, err = Parse("../common/testdata", "", "", "error_template")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Matches, "Can't parse file ../common/testdata/error_template.mock:8 - template in section RESPONSE is malformed: .*")
+
+	_, err = Parse("../common/testdata", "", "", "error_body")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Matches, "Can't parse file ../common/testdata/error_body.mock:7:1 - section MATCH-BODY is malformed: .*")
+
+	_, err = Parse("../common/testdata", "", "", "error_body_type")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_body_type.mock:7:1 - section MATCH-BODY is malformed: unknown matching type jsn (\"@MATCH-BODY:jsn\")")
+
+	_, err = Parse("../common/testdata", "", "", "error_body_duplicate")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't parse file ../common/testdata/error_body_duplicate.mock:10:1 - section MATCH-BODY is already defined on line 7 (\"@MATCH-BODY:contains\")")
 
 	var (
 		nilRule *Rule
@@ -80,6 +148,10 @@ func (s *ParseSuite) TestParsingError(c *C) {
 	c.Assert(nilResp.String(), Equals, "Nil")
 	c.Assert(nilReq.String(), Equals, "Nil")
 	c.Assert(nilResp.Body(), Equals, "")
+
+	_, err = nilResp.Template()
+
+	c.Assert(err, Not(IsNil))
 }
 
 func (s *ParseSuite) TestParsing(c *C) {
@@ -119,6 +191,17 @@ func (s *ParseSuite) TestParsing(c *C) {
 
 	c.Assert(rule.Responses["3"].URL, Equals, "http://www.domain.com")
 
+	c.Assert(rule.Responses["1"].tmpl, Not(IsNil))
+	c.Assert(rule.Responses["2"].tmpl, IsNil)
+
+	tmpl, err := rule.Responses["2"].Template()
+
+	c.Assert(tmpl, Not(IsNil))
+	c.Assert(err, IsNil)
+
+	c.Assert(rule.LoadFiles(), IsNil)
+	c.Assert(rule.Responses["2"].tmpl, Not(IsNil))
+
 	c.Assert(rule.String(), Not(Equals), "")
 	c.Assert(rule.Request.String(), Not(Equals), "")
 	c.Assert(rule.Responses["1"].String(), Not(Equals), "")
@@ -146,6 +229,146 @@ func (s *ParseSuite) TestMultiresponseParsing(c *C) {
 	c.Assert(rule.Responses["2"].Code, Equals, 404)
 	c.Assert(rule.Responses["2"].Headers["X-Header"], Equals, "2")
 	c.Assert(rule.Responses["2"].Delay, Equals, 5.5)
+
+	c.Assert(rule.SectionLine("REQUEST", DEFAULT), Equals, 4)
+	c.Assert(rule.SectionLine("RESPONSE", "2"), Equals, 10)
+	c.Assert(rule.SectionLine("DELAY", "2"), Equals, 25)
+	c.Assert(rule.SectionLine("DELAY", "1"), Equals, 0)
+}
+
+func (s *ParseSuite) TestResponseSelection(c *C) {
+	rule, err := Parse("../common/testdata", "", "", "modes")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(err, IsNil)
+
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/modes", nil)
+
+	c.Assert(rule.Mode, Equals, MODE_SEQUENTIAL)
+	c.Assert(rule.Responses["10"].Weight, Equals, 3)
+
+	for _, expected := range []string{"1", "2", "10", "10"} {
+		id, resp := rule.SelectResponse(req, nil, nil)
+		c.Assert(id, Equals, expected)
+		c.Assert(resp, Equals, rule.Responses[expected])
+	}
+
+	rule.Mode, rule.calls = MODE_ROUND_ROBIN, 0
+
+	for _, expected := range []string{"1", "2", "10", "1"} {
+		id, _ := rule.SelectResponse(req, nil, nil)
+		c.Assert(id, Equals, expected)
+	}
+
+	rule.Mode = MODE_WEIGHTED
+	rule.Responses["1"].Weight = 1000000
+
+	id, _ := rule.SelectResponse(req, nil, nil)
+	c.Assert(id, Not(Equals), "")
+
+	rule.Mode = MODE_RANDOM
+
+	id, _ = rule.SelectResponse(req, nil, nil)
+	c.Assert(rule.Responses[id], Not(IsNil))
+}
+
+func (s *ParseSuite) TestConditionalResponses(c *C) {
+	rule, err := Parse("../common/testdata", "", "", "when")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(err, IsNil)
+
+	c.Assert(rule.Responses["admin"].When, HasLen, 2)
+	c.Assert(rule.Responses["admin"].When[0].String(), Equals, "header:X-Role=admin")
+	c.Assert(rule.Responses["admin"].When[1].String(), Equals, "query:debug")
+
+	req, _ := http.NewRequest("POST", "http://127.0.0.1/users/1?debug", nil)
+	req.Header.Set("X-Role", "admin")
+
+	c.Assert(findRule(RuleListMap{}, RuleList{rule}, newScenarioStates(), req, nil, false), Equals, rule)
+
+	id, _ := rule.SelectResponse(req, nil, map[string]string{"id": "1"})
+	c.Assert(id, Equals, "admin")
+
+	req, _ = http.NewRequest("POST", "http://127.0.0.1/users/1", nil)
+	req.Header.Set("X-Role", "admin")
+
+	id, _ = rule.SelectResponse(req, []byte(`{"user":{"roles":["guest"]}}`), map[string]string{"id": "1"})
+	c.Assert(id, Equals, "user")
+
+	req, _ = http.NewRequest("POST", "http://127.0.0.1/users/7", nil)
+
+	id, _ = rule.SelectResponse(req, nil, map[string]string{"id": "7"})
+	c.Assert(id, Equals, "7")
+
+	req, _ = http.NewRequest("POST", "http://127.0.0.1/users/2", nil)
+
+	id, resp := rule.SelectResponse(req, []byte(`{"user":{"roles":["admin"]}}`), map[string]string{"id": "2"})
+	c.Assert(id, Equals, DEFAULT)
+	c.Assert(resp.Code, Equals, 404)
+
+	id, resp = rule.SelectResponse(req, nil, map[string]string{"id": "2"})
+	c.Assert(id, Equals, DEFAULT)
+	c.Assert(resp.Code, Equals, 404)
+
+	delete(rule.Responses, DEFAULT)
+
+	id, resp = rule.SelectResponse(req, nil, map[string]string{"id": "2"})
+	c.Assert(id, Equals, "extra")
+	c.Assert(resp.Code, Equals, 203)
+
+	delete(rule.Responses, "extra")
+
+	id, resp = rule.SelectResponse(req, nil, map[string]string{"id": "2"})
+	c.Assert(id, Equals, "")
+	c.Assert(resp, IsNil)
+}
+
+func (s *ParseSuite) TestSeedParsing(c *C) {
+	rule, err := Parse("../common/testdata", "", "", "seed")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(err, IsNil)
+	c.Assert(rule.Seed.String(), Equals, "param:id")
+
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/users/1", nil)
+
+	c.Assert(rule.Seed.Get(req, nil, map[string]string{"id": "1"}), Equals, rule.Seed.Get(req, nil, map[string]string{"id": "1"}))
+	c.Assert(rule.Seed.Get(req, nil, map[string]string{"id": "1"}), Not(Equals), rule.Seed.Get(req, nil, map[string]string{"id": "2"}))
+
+	seed, err := parseSeed("42")
+
+	c.Assert(err, IsNil)
+	c.Assert(seed.Get(req, nil, nil), Equals, int64(42))
+	c.Assert(seed.String(), Equals, "42")
+
+	_, err = parseSeed("abc")
+	c.Assert(err, Not(IsNil))
+
+	_, err = parseSeed("query:")
+	c.Assert(err, Not(IsNil))
+
+	var nilSeed *Seed
+
+	c.Assert(nilSeed.String(), Equals, "Nil")
+}
+
+func (s *ParseSuite) TestUnknownSections(c *C) {
+	rule, err := Parse("../common/testdata", "", "", "warn_section")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(err, IsNil)
+	c.Assert(rule.Warnings, HasLen, 1)
+	c.Assert(rule.Warnings[0].Line, Equals, 7)
+	c.Assert(rule.Warnings[0].Column, Equals, 1)
+	c.Assert(rule.Warnings[0].Message, Equals, "unknown section RESPONCE")
+	c.Assert(rule.Warnings[0].Location(), Equals, "../common/testdata/warn_section.mock:7:1")
+	c.Assert(rule.Responses[DEFAULT].Content, Equals, "")
+
+	rule, err = Parse("../common/testdata", "", "", "seed")
+
+	c.Assert(err, IsNil)
+	c.Assert(rule.Warnings, HasLen, 0)
 }
 
 func (s *ParseSuite) TestFileResponseParsing(c *C) {
@@ -217,6 +440,30 @@ func (s *ParseSuite) TestWildcardRuleParsing(c *C) {
 
 	c.Assert(rule, Not(IsNil))
 	c.Assert(err, IsNil)
+	c.Assert(rule.IsWildcard, Equals, true)
+
+	rule, err = Parse("../common/testdata", "", "", "params")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(err, IsNil)
+	c.Assert(rule.IsWildcard, Equals, true)
+	c.Assert(rule.Request.NURL, Equals, "/users/{id}/orders/{orderId}")
+	c.Assert(rule.Request.re, Not(IsNil))
+	c.Assert(rule.Request.MatchURL("/users/1/orders/2?limit=10"), Equals, true)
+	c.Assert(rule.Request.MatchURL("/users/1/orders"), Equals, false)
+	c.Assert(rule.Request.URLParams("/users/1/orders/2"), DeepEquals, map[string]string{"id": "1", "orderId": "2"})
+
+	rule, err = Parse("../common/testdata", "", "", "regexp")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(err, IsNil)
+	c.Assert(rule.IsWildcard, Equals, true)
+	c.Assert(rule.Request.URL, Equals, "~^/api/v[12]/items/(?P<id>\\d+)$")
+	c.Assert(rule.Request.NURL, Equals, "~^/api/v[12]/items/(?P<id>\\d+)$")
+	c.Assert(rule.Request.URI, Equals, ":GET:~^/api/v[12]/items/(?P<id>\\d+)$")
+	c.Assert(rule.Request.re, Not(IsNil))
+	c.Assert(rule.Request.URLParams("/api/v1/items/12"), DeepEquals, map[string]string{"id": "12"})
+	c.Assert(rule.Request.URLParams("/api/v3/items/12"), IsNil)
 }
 
 func (s *ParseSuite) TestEmptyResponseRuleParsing(c *C) {
@@ -270,6 +517,344 @@ func (s *ParseSuite) TestDifferentOrder(c *C) {
 	c.Assert(rule.Responses["2"].File, Equals, "")
 }
 
+func (s *ParseSuite) TestBodyMatcherParsing(c *C) {
+	var (
+		rule *Rule
+		err  error
+	)
+
+	rule, err = Parse("../common/testdata", "", "", "body_match")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(err, IsNil)
+
+	c.Assert(rule.Request.Body, Not(IsNil))
+	c.Assert(rule.Request.Body.Type, Equals, MATCH_JSON)
+	c.Assert(rule.Request.Body.Match([]byte(`{"amount":100,"currency":"USD","tags":["prod","test"]}`)), Equals, true)
+	c.Assert(rule.Request.Body.Match([]byte(`{"amount":200,"currency":"USD","tags":["test"]}`)), Equals, false)
+	c.Assert(rule.Request.Body.Match([]byte(`{"amount":100}`)), Equals, false)
+	c.Assert(rule.Request.Body.Match([]byte(`amount=100`)), Equals, false)
+
+	rule, err = Parse("../common/testdata", "", "", "body_regex")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(err, IsNil)
+
+	c.Assert(rule.Request.Body, Not(IsNil))
+	c.Assert(rule.Request.Body.Type, Equals, MATCH_REGEX)
+	c.Assert(rule.Request.Body.Match([]byte(`amount=100&currency=USD`)), Equals, true)
+	c.Assert(rule.Request.Body.Match([]byte(`amount=100&currency=EUR`)), Equals, false)
+
+	// regexp is alias for regex matching type
+	matchType, err := getMatchType("regexp")
+
+	c.Assert(err, IsNil)
+	c.Assert(matchType, Equals, MATCH_REGEX)
+
+	matchType, err = getMatchType("REGEX")
+
+	c.Assert(err, IsNil)
+	c.Assert(matchType, Equals, MATCH_REGEX)
+
+	matchType, err = getMatchType(DEFAULT)
+
+	c.Assert(err, IsNil)
+	c.Assert(matchType, Equals, MATCH_EXACT)
+
+	_, err = getMatchType("jsn")
+
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *ParseSuite) TestBodyMatching(c *C) {
+	var (
+		nilMatcher *BodyMatcher
+		matcher    *BodyMatcher
+	)
+
+	c.Assert(nilMatcher.Match([]byte("test")), Equals, true)
+	c.Assert(nilMatcher.String(), Equals, "Nil")
+	c.Assert(nilMatcher.Equal(nil), Equals, true)
+
+	matcher = &BodyMatcher{Type: MATCH_EXACT, Content: "id=1&user=bob\n"}
+
+	c.Assert(matcher.compile(), IsNil)
+	c.Assert(matcher.Match([]byte("id=1&user=bob")), Equals, true)
+	c.Assert(matcher.Match([]byte("id=1&user=john")), Equals, false)
+	c.Assert(matcher.Equal(nilMatcher), Equals, false)
+	c.Assert(matcher.String(), Not(Equals), "")
+
+	matcher = &BodyMatcher{Type: MATCH_CONTAINS, Content: "user=bob"}
+
+	c.Assert(matcher.compile(), IsNil)
+	c.Assert(matcher.Match([]byte("id=1&user=bob")), Equals, true)
+	c.Assert(matcher.Match([]byte("id=1&user=john")), Equals, false)
+
+	matcher = &BodyMatcher{Type: MATCH_REGEX, Content: "^id=[0-9]+&"}
+
+	c.Assert(matcher.compile(), IsNil)
+	c.Assert(matcher.Match([]byte("id=12&user=bob")), Equals, true)
+	c.Assert(matcher.Match([]byte("id=A&user=bob")), Equals, false)
+
+	matcher = &BodyMatcher{Type: MATCH_JSON, Content: "{\"id\":"}
+
+	c.Assert(matcher.compile(), Not(IsNil))
+
+	matcher = &BodyMatcher{Type: "unknown"}
+
+	c.Assert(matcher.compile(), Not(IsNil))
+}
+
+func (s *ParseSuite) TestHeadersMatcherParsing(c *C) {
+	var (
+		rule *Rule
+		err  error
+	)
+
+	rule, err = Parse("../common/testdata", "", "", "headers_match")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(err, IsNil)
+
+	c.Assert(rule.Request.Headers, HasLen, 3)
+	c.Assert(rule.Request.Cookies, HasLen, 1)
+	c.Assert(rule.Request.MatchersNum(), Equals, 4)
+
+	c.Assert(rule.Request.Headers[0].Name, Equals, "X-Api-Key")
+	c.Assert(rule.Request.Headers[0].Value, Equals, "abcd:1234")
+	c.Assert(rule.Request.Headers[1].Name, Equals, "X-Trace-Id")
+	c.Assert(rule.Request.Headers[1].Value, Equals, "")
+	c.Assert(rule.Request.Headers[2].Value, Equals, "~^v[12]$")
+
+	r, _ := http.NewRequest("GET", "/test", nil)
+
+	c.Assert(rule.Request.Match(r, nil), Equals, false)
+
+	r.Header.Set("X-Api-Key", "abcd:1234")
+	r.Header.Set("X-Trace-Id", "1")
+	r.Header.Set("X-Version", "v2")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "test"})
+
+	c.Assert(rule.Request.Match(r, nil), Equals, true)
+
+	r.Header.Set("X-Version", "v3")
+
+	c.Assert(rule.Request.Match(r, nil), Equals, false)
+
+	r.Header.Set("X-Version", "v1")
+	r.Header.Del("Cookie")
+
+	c.Assert(rule.Request.Match(r, nil), Equals, false)
+
+	r.AddCookie(&http.Cookie{Name: "session", Value: "test"})
+
+	c.Assert(rule.Request.Match(r, nil), Equals, true)
+
+	rule2 := &Request{Headers: rule.Request.Headers[:2]}
+
+	c.Assert(rule.Request.SameMatchers(rule.Request), Equals, true)
+	c.Assert(rule.Request.SameMatchers(rule2), Equals, false)
+	c.Assert(rule2.Match(r, nil), Equals, true)
+
+	// Header names are case-insensitive, cookie names are case-sensitive
+	c.Assert(
+		(&Request{Headers: []*ValueMatcher{{Name: "X-Version"}}}).SameMatchers(
+			&Request{Headers: []*ValueMatcher{{Name: "x-version"}}},
+		), Equals, true,
+	)
+	c.Assert(
+		(&Request{Cookies: []*ValueMatcher{{Name: "Session"}}}).SameMatchers(
+			&Request{Cookies: []*ValueMatcher{{Name: "session"}}},
+		), Equals, false,
+	)
+
+	_, err = parseValueMatcher(":1234")
+
+	c.Assert(err, Not(IsNil))
+
+	_, err = parseValueMatcher("X-Version:~^v[12$")
+
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *ParseSuite) TestRequestBodyReading(c *C) {
+	r, _ := http.NewRequest("POST", "/test", strings.NewReader("test1234"))
+
+	data, err := ReadBody(r)
+
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "test1234")
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	c.Assert(string(body), Equals, "test1234")
+
+	r, _ = http.NewRequest("GET", "/test", nil)
+
+	data, err = ReadBody(r)
+
+	c.Assert(err, IsNil)
+	c.Assert(data, IsNil)
+
+	bigData := strings.Repeat("a", MAX_BODY_SIZE+10)
+	r, _ = http.NewRequest("POST", "/test", strings.NewReader(bigData))
+
+	data, err = ReadBody(r)
+
+	c.Assert(err, Equals, ErrBodyTooLarge)
+	c.Assert(data, IsNil)
+
+	body, _ = ioutil.ReadAll(r.Body)
+
+	c.Assert(string(body), Equals, bigData)
+
+	// Matchers use given body and don't read request body
+	r, _ = http.NewRequest("POST", "/test", strings.NewReader("id=2"))
+	origBody := r.Body
+	matcher := &Request{Body: &BodyMatcher{Type: MATCH_EXACT, Content: "id=1\n"}}
+
+	c.Assert(matcher.Body.compile(), IsNil)
+	c.Assert(matcher.Match(r, []byte("id=1")), Equals, true)
+	c.Assert(matcher.Match(r, nil), Equals, false)
+	c.Assert(r.Body, Equals, origBody)
+}
+
+func (s *ParseSuite) TestRulesPriority(c *C) {
+	rule, err := Parse("../common/testdata", "", "", "priority")
+
+	c.Assert(rule, Not(IsNil))
+	c.Assert(err, IsNil)
+	c.Assert(rule.Priority, Equals, 10)
+
+	var list RuleList
+
+	makeRule := func(path, url string, priority int) *Rule {
+		rule := NewRule()
+		rule.Path, rule.Priority = path, priority
+		rule.Request = &Request{Method: "GET", URL: url, NURL: url}
+		return rule
+	}
+
+	list = list.insert(makeRule("5", "/*", 0))
+	list = list.insert(makeRule("4", "/users/*/orders/*", 0))
+	list = list.insert(makeRule("3", "/user*", 0))
+	list = list.insert(makeRule("2", "/users/{id}/orders/*", 0))
+	list = list.insert(makeRule("1", "/*", 10))
+	list = list.insert(makeRule("0", "/*", 10))
+	list = list.insert(makeRule("6", "~^/users/\\d+$", 0))
+
+	var paths []string
+
+	for _, r := range list {
+		paths = append(paths, r.Path)
+	}
+
+	c.Assert(paths, DeepEquals, []string{"0", "1", "6", "2", "4", "3", "5"})
+
+	list = list.exclude(list[0]).exclude(list[1])
+
+	r, _ := http.NewRequest("GET", "http://127.0.0.1/users/1/orders/2", nil)
+
+	c.Assert(findRule(RuleListMap{}, list, newScenarioStates(), r, nil, false).Path, Equals, "2")
+
+	r, _ = http.NewRequest("GET", "http://127.0.0.1/users/123", nil)
+
+	c.Assert(findRule(RuleListMap{}, list, newScenarioStates(), r, nil, false).Path, Equals, "6")
+
+	r, _ = http.NewRequest("GET", "http://127.0.0.1/users/john", nil)
+
+	c.Assert(findRule(RuleListMap{}, list, newScenarioStates(), r, nil, false).Path, Equals, "3")
+
+	r, _ = http.NewRequest("GET", "http://127.0.0.1/orders", nil)
+
+	c.Assert(findRule(RuleListMap{}, list, newScenarioStates(), r, nil, false).Path, Equals, "5")
+
+	uriMap := RuleListMap{
+		":GET:/orders":         RuleList{makeRule("7", "/orders", 0)},
+		":GET:/orders?limit=1": RuleList{makeRule("8", "/orders?limit=1", 0)},
+	}
+
+	r, _ = http.NewRequest("GET", "http://127.0.0.1/orders?limit=1", nil)
+
+	c.Assert(findRule(uriMap, nil, newScenarioStates(), r, nil, false).Path, Equals, "8")
+
+	// Rule without query in URL doesn't match request with extra query string
+	r, _ = http.NewRequest("GET", "http://127.0.0.1/orders?limit=10", nil)
+
+	c.Assert(findRule(uriMap, nil, newScenarioStates(), r, nil, false), IsNil)
+	c.Assert(findRule(uriMap, list, newScenarioStates(), r, nil, false).Path, Equals, "5")
+
+	// Priority doesn't affect exact rules
+	er, _ := http.NewRequest("GET", "http://127.0.0.1/orders", nil)
+	list = list.insert(makeRule("11", "/orders*", 100))
+
+	c.Assert(findRule(uriMap, list, newScenarioStates(), er, nil, false).Path, Equals, "7")
+
+	// Rule with conditions for query params matches request with any query string
+	rule = makeRule("9", "/orders", 0)
+	rule.Responses["debug"] = &Response{When: []*Condition{{Source: SOURCE_QUERY, Matcher: &ValueMatcher{Name: "debug"}}}}
+	uriMap[":GET:/orders"] = RuleList{uriMap[":GET:/orders"][0], rule}
+
+	c.Assert(findRule(uriMap, nil, newScenarioStates(), r, nil, false).Path, Equals, "9")
+
+	// Same for wildcard rules
+	wcList := RuleList{makeRule("10", "/users/*/orders", 0)}
+	r, _ = http.NewRequest("GET", "http://127.0.0.1/users/1/orders?debug", nil)
+
+	c.Assert(findRule(RuleListMap{}, wcList, newScenarioStates(), r, nil, false), IsNil)
+
+	wcList[0].Responses["debug"] = rule.Responses["debug"]
+
+	c.Assert(findRule(RuleListMap{}, wcList, newScenarioStates(), r, nil, false).Path, Equals, "10")
+}
+
+func (s *ParseSuite) TestRulesConflicts(c *C) {
+	makeRule := func(path, url string, priority int) *Rule {
+		rule := NewRule()
+		rule.Path, rule.PrettyPath, rule.Priority = path, path, priority
+		rule.Request = &Request{Method: "GET", URL: url, NURL: url, URI: ":GET:" + url}
+		rule.IsWildcard = strings.ContainsAny(url, "*{~")
+		return rule
+	}
+
+	list := []*Rule{
+		makeRule("1", "/users", 0),
+		makeRule("2", "/users", 0),
+		makeRule("3", "/orders/*", 0),
+		makeRule("4", "/orders/{id}", 0),
+		makeRule("5", "/items/*", 10),
+		makeRule("6", "/items/{id}/price", 0),
+		makeRule("7", "/shop/*", 10),
+		makeRule("8", "/shop/{id}", 0),
+		makeRule("9", "/books/{id}", 10),
+		makeRule("10", "/books/*", 0),
+	}
+
+	list[6].Request.Headers = []*ValueMatcher{{Name: "X-Version"}}
+
+	conflicts := FindConflicts(list[0], list)
+
+	c.Assert(conflicts, HasLen, 1)
+	c.Assert(conflicts[0].Type, Equals, CONFLICT_DUPLICATE)
+	c.Assert(conflicts[0].Other.Path, Equals, "2")
+
+	conflicts = FindConflicts(list[3], list)
+
+	c.Assert(conflicts, HasLen, 1)
+	c.Assert(conflicts[0].Type, Equals, CONFLICT_OVERLAP)
+	c.Assert(conflicts[0].Other.Path, Equals, "3")
+
+	conflicts = FindConflicts(list[5], list)
+
+	c.Assert(conflicts, HasLen, 1)
+	c.Assert(conflicts[0].Type, Equals, CONFLICT_SHADOW)
+	c.Assert(conflicts[0].Other.Path, Equals, "5")
+
+	c.Assert(FindConflicts(list[4], list), HasLen, 0)
+	c.Assert(FindConflicts(list[7], list), HasLen, 0)
+	c.Assert(FindConflicts(list[9], list), HasLen, 0)
+}
+
 func (s *ParseSuite) TestPathParsing(c *C) {
 	var service, mock, dir string
 
@@ -10,15 +10,32 @@ package rules
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"text/template"
 	"time"
 
+	"pkg.re/essentialkaos/ek.v3/fsutil"
+	"pkg.re/essentialkaos/ek.v3/rand"
 	"pkg.re/essentialkaos/ek.v3/timeutil"
+
+	"github.com/essentialkaos/mockka/tmplutil"
 )
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 const DEFAULT = "_default"
 
+const (
+	MODE_RANDOM      = "random"
+	MODE_SEQUENTIAL  = "sequential"
+	MODE_ROUND_ROBIN = "round-robin"
+	MODE_WEIGHTED    = "weighted"
+)
+
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 type Rule struct {
@@ -32,21 +49,57 @@ type Rule struct {
 	Auth       *Auth                // Basic auth login and pass
 	Request    *Request             // Request method and url
 	Responses  map[string]*Response // Responses map
+	Priority   int                  // Rule priority (wildcard rules with bigger priority are checked first)
+	Scenario   string               // Scenario name
+	Mode       string               // Response selection mode
+	Seed       *Seed                // Seed for fake data generation (nil - random data)
+
+	RequiredState string // Scenario state required for using rule
+	NewState      string // Scenario state after using rule
+
 	ModTime    time.Time            // Mock file mod time
-	IsWildcard bool                 // Wildcard marker
+	Files      map[string]time.Time // Response files -> mod time
+	IsWildcard bool                 // Wildcard marker (url contains wildcards or named params)
+	InMemory   bool                 // Rule created in runtime without mock file
+
+	Sections map[string]int // Section name (with response id) -> number of line with section header
+	Warnings []*ParseError  // Non-fatal problems found while parsing
+
+	calls uint32 // Number of responses selections
+}
+
+// PositionError is error with position in file
+type PositionError struct {
+	Line    int    // Line number
+	Column  int    // Column number (0 - unknown)
+	Message string // Error message
+}
+
+// ParseError is error or warning with position in mock file
+type ParseError struct {
+	File    string // Path to mock file
+	Line    int    // Line number (0 - error is not related to any line)
+	Column  int    // Column number (0 - unknown)
+	Text    string // Offending text
+	Message string // Error message
 }
 
 type Auth struct {
 	User     string // Username
-	Password string // Password
+	Password string `json:"-"` // Password (hidden in admin API responses)
 }
 
 type Request struct {
-	Host   string // Request host
-	Method string // Request method
-	URL    string // Request URL
-	NURL   string // Normalized (sorted) URL
-	URI    string // URI (host + method + normalized url)
+	Host    string          // Request host
+	Method  string          // Request method
+	URL     string          // Request URL
+	NURL    string          // Normalized (sorted) URL
+	URI     string          // URI (host + method + normalized url)
+	Body    *BodyMatcher    // Request body matcher
+	Headers []*ValueMatcher // Request headers matchers
+	Cookies []*ValueMatcher // Request cookies matchers
+
+	re *regexp.Regexp // Compiled regexp for regexp URL or URL with named params
 }
 
 type Response struct {
@@ -57,21 +110,64 @@ type Response struct {
 	Headers   map[string]string // Map with headers
 	Delay     float64           // Response delay
 	Overwrite bool              // Proxying overwrite mode flag
+	Weight    int               // Response weight for weighted selection mode
+	When      []*Condition      // Conditions for response selection
+
+	body   string             // Cached content of response file
+	cached bool               // Response file content cache marker
+	tmpl   *template.Template // Parsed response template
+	lines  []int              // Numbers of mock file lines with response content
 }
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
+// templateErrorRegexp is regexp for extracting position from template errors
+var templateErrorRegexp = regexp.MustCompile(`(?s)^template: [^:]*:(\d+):(?:(\d+):)? (?:executing "[^"]*" at )?(.*)$`)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
 // Create new rule struct
 func NewRule() *Rule {
 	return &Rule{
 		Auth:      &Auth{},
 		Request:   &Request{},
 		Responses: make(map[string]*Response),
+		Sections:  make(map[string]int),
 	}
 }
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
+// Error return error message with position
+func (e *PositionError) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+
+	return fmt.Sprintf("line %d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Error return error message with position and offending text
+func (e *ParseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("Can't parse file %s - %s", e.Location(), e.Message)
+	}
+
+	return fmt.Sprintf("Can't parse file %s - %s (%q)", e.Location(), e.Message, e.Text)
+}
+
+// Location return position of error in file:line:column format
+func (e *ParseError) Location() string {
+	switch {
+	case e.Line == 0:
+		return e.File
+	case e.Column == 0:
+		return fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+}
+
 // String return string with request info
 func (r *Request) String() string {
 	if r == nil {
@@ -85,8 +181,8 @@ func (r *Request) String() string {
 	}
 
 	return fmt.Sprintf(
-		"Host: %s | Method: %s | URL: %s | NURL: %s | URI: %s",
-		host, r.Method, r.URL, r.NURL, r.URI,
+		"Host: %s | Method: %s | URL: %s | NURL: %s | URI: %s | MatchersNum: %d",
+		host, r.Method, r.URL, r.NURL, r.URI, r.MatchersNum(),
 	)
 }
 
@@ -108,8 +204,8 @@ func (r *Rule) String() string {
 	}
 
 	return fmt.Sprintf(
-		"FullName: %s | Service: %s | Dir: %s | Path: %s | Desc: %t | Auth: %s | ResponsesN: %d | ModTime: %s | IsWildcard: %t",
-		r.FullName, r.Service, dir, r.Path, r.Desc != "", auth, len(r.Responses),
+		"FullName: %s | Service: %s | Dir: %s | Path: %s | Desc: %t | Auth: %s | ResponsesN: %d | Priority: %d | ModTime: %s | IsWildcard: %t",
+		r.FullName, r.Service, dir, r.Path, r.Desc != "", auth, len(r.Responses), r.Priority,
 		timeutil.Format(r.ModTime, "%Y/%m/%d %H:%M:%S"), r.IsWildcard,
 	)
 }
@@ -132,11 +228,128 @@ func (r *Response) String() string {
 	}
 
 	return fmt.Sprintf(
-		"ContentSyms: %d | File: %s | URL: %s | Code: %d | HeadersNum: %d | Delay: %g | OverwriteFlag: %t",
-		len(r.Content), file, url, r.Code, len(r.Headers), r.Delay, r.Overwrite,
+		"ContentSyms: %d | File: %s | URL: %s | Code: %d | HeadersNum: %d | Delay: %g | OverwriteFlag: %t | ConditionsNum: %d",
+		len(r.Content), file, url, r.Code, len(r.Headers), r.Delay, r.Overwrite, len(r.When),
 	)
 }
 
+// SectionLine return number of line with header of section with given
+// response id (0 if rule doesn't have such section)
+func (r *Rule) SectionLine(section, id string) int {
+	return r.Sections[getSectionKey(section, id)]
+}
+
+// SelectResponse select response for given request and return response
+// id and response. Response with fitting conditions is used first, if no
+// one fits, default response is used as a fallback. Rules without conditional
+// responses select response according to rule mode from responses without
+// conditions (default response is used only if there are no such responses).
+func (r *Rule) SelectResponse(req *http.Request, body []byte, params map[string]string) (string, *Response) {
+	if len(r.Responses) == 1 {
+		for id, resp := range r.Responses {
+			if len(resp.When) == 0 || resp.fit(req, body, params) {
+				return id, resp
+			}
+		}
+
+		return "", nil
+	}
+
+	var ids []string
+	var conditional bool
+
+	for _, id := range r.getResponsesIDs() {
+		resp := r.Responses[id]
+
+		switch {
+		case len(resp.When) == 0:
+			ids = append(ids, id)
+		case resp.fit(req, body, params):
+			return id, resp
+		default:
+			conditional = true
+		}
+	}
+
+	defResp, hasDefault := r.Responses[DEFAULT]
+
+	switch {
+	case hasDefault && (conditional || len(ids) == 0):
+		return DEFAULT, defResp
+	case len(ids) == 0:
+		return "", nil
+	}
+
+	call := int(atomic.AddUint32(&r.calls, 1) - 1)
+
+	var id string
+
+	switch r.Mode {
+	case MODE_SEQUENTIAL:
+		if call >= len(ids) {
+			call = len(ids) - 1
+		}
+
+		id = ids[call]
+
+	case MODE_ROUND_ROBIN:
+		id = ids[call%len(ids)]
+
+	case MODE_WEIGHTED:
+		id = r.getWeightedResponseID(ids)
+
+	default:
+		id = ids[rand.Int(len(ids))]
+	}
+
+	return id, r.Responses[id]
+}
+
+// LoadFiles read and cache content of all response files
+func (r *Rule) LoadFiles() error {
+	files := make(map[string]time.Time)
+
+	for _, resp := range r.Responses {
+		if resp.File == "" {
+			continue
+		}
+
+		switch {
+		case !fsutil.IsExist(resp.File):
+			return fmt.Errorf("File %s with response body is not exist", resp.File)
+		case !fsutil.IsReadable(resp.File):
+			return fmt.Errorf("File %s with response body is not readable", resp.File)
+		}
+
+		mtime, err := fsutil.GetMTime(resp.File)
+
+		if err != nil {
+			return err
+		}
+
+		body, err := ioutil.ReadFile(resp.File)
+
+		if err != nil {
+			return err
+		}
+
+		resp.body = string(body)
+		resp.cached = true
+
+		err = resp.compile()
+
+		if err != nil {
+			return fmt.Errorf("Can't parse template in file %s: %v", resp.File, resp.TemplateError(err))
+		}
+
+		files[resp.File] = mtime
+	}
+
+	r.Files = files
+
+	return nil
+}
+
 // Body return reponse body
 func (r *Response) Body() string {
 	if r == nil {
@@ -144,6 +357,10 @@ func (r *Response) Body() string {
 	}
 
 	if r.File != "" {
+		if r.cached {
+			return r.body
+		}
+
 		body, err := ioutil.ReadFile(r.File)
 
 		if err != nil {
@@ -156,4 +373,190 @@ func (r *Response) Body() string {
 	return r.Content
 }
 
+// Template return parsed response template, template is parsed on the fly
+// if response wasn't prepared while rule loading
+func (r *Response) Template() (*template.Template, error) {
+	if r == nil {
+		return nil, fmt.Errorf("Response is nil")
+	}
+
+	if r.tmpl != nil {
+		return r.tmpl, nil
+	}
+
+	return parseTemplate(r.Body())
+}
+
+// TemplateError convert template parsing or rendering error to error with
+// number of line in mock file (or in response file for file responses)
+func (r *Response) TemplateError(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+
+	match := templateErrorRegexp.FindStringSubmatch(err.Error())
+
+	if match == nil {
+		return err
+	}
+
+	line, _ := strconv.Atoi(match[1])
+	result := &PositionError{Line: r.getSourceLine(line), Message: match[3]}
+
+	if match[2] != "" {
+		// Template package counts columns from zero
+		column, _ := strconv.Atoi(match[2])
+		result.Column = column + 1
+	}
+
+	return result
+}
+
 // ////////////////////////////////////////////////////////////////////////////////// //
+
+// compile parse response body and cache parsed template
+func (r *Response) compile() error {
+	tmpl, err := parseTemplate(r.Body())
+
+	if err != nil {
+		return err
+	}
+
+	r.tmpl = tmpl
+
+	return nil
+}
+
+// getSourceLine return number of line in mock file for given line of
+// response content
+func (r *Response) getSourceLine(line int) int {
+	if r.File != "" || line <= 0 || line > len(r.lines) {
+		return line
+	}
+
+	return r.lines[line-1]
+}
+
+// isFilesChanged return true if some of response files was changed or deleted
+func (r *Rule) isFilesChanged() bool {
+	for file, modTime := range r.Files {
+		mtime, err := fsutil.GetMTime(file)
+
+		if err != nil || mtime.UnixNano() != modTime.UnixNano() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getSectionKey return key for sections map
+func getSectionKey(section, id string) string {
+	if id == DEFAULT {
+		return section
+	}
+
+	return section + ":" + id
+}
+
+// hasUnconditionalResponse return true if rule has at least one response
+// without conditions
+func (r *Rule) hasUnconditionalResponse() bool {
+	for _, resp := range r.Responses {
+		if len(resp.When) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasQueryConditions return true if rule has at least one response with
+// conditions for query params
+func (r *Rule) hasQueryConditions() bool {
+	for _, resp := range r.Responses {
+		for _, cond := range resp.When {
+			if cond.Source == SOURCE_QUERY {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// getResponsesIDs return sorted slice with responses ids (without default response)
+func (r *Rule) getResponsesIDs() []string {
+	var ids []string
+
+	for id := range r.Responses {
+		if id != DEFAULT {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Sort(responseIDs(ids))
+
+	return ids
+}
+
+// getWeightedResponseID return random response id with respect to responses weights
+func (r *Rule) getWeightedResponseID(ids []string) string {
+	var total int
+
+	for _, id := range ids {
+		total += getWeight(r.Responses[id])
+	}
+
+	point := rand.Int(total)
+
+	for _, id := range ids {
+		point -= getWeight(r.Responses[id])
+
+		if point < 0 {
+			return id
+		}
+	}
+
+	return ids[len(ids)-1]
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// responseIDs is slice with responses ids, numeric ids are sorted as numbers
+type responseIDs []string
+
+func (s responseIDs) Len() int      { return len(s) }
+func (s responseIDs) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s responseIDs) Less(i, j int) bool {
+	n1, err1 := strconv.Atoi(s[i])
+	n2, err2 := strconv.Atoi(s[j])
+
+	switch {
+	case err1 == nil && err2 == nil:
+		return n1 < n2
+	case err1 == nil:
+		return true
+	case err2 == nil:
+		return false
+	}
+
+	return s[i] < s[j]
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// parseTemplate parse response template with helpers
+func parseTemplate(content string) (*template.Template, error) {
+	return template.New("").Funcs(tmplutil.Funcs()).Parse(content)
+}
+
+// getWeight return response weight (1 by default)
+func getWeight(resp *Response) int {
+	if resp.Weight <= 0 {
+		return 1
+	}
+
+	return resp.Weight
+}
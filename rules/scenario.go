@@ -0,0 +1,93 @@
+package rules
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"sync"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// STATE_STARTED is initial state of all scenarios
+const STATE_STARTED = "started"
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// scenarioStates contains current states of scenarios
+type scenarioStates struct {
+	states map[string]string // scenario name -> current state
+	mu     sync.RWMutex      // lock for states map
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// newScenarioStates create new struct for scenarios states
+func newScenarioStates() *scenarioStates {
+	return &scenarioStates{states: make(map[string]string)}
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// get return current state of scenario
+func (s *scenarioStates) get(scenario string) string {
+	s.mu.RLock()
+	state, ok := s.states[scenario]
+	s.mu.RUnlock()
+
+	if !ok {
+		return STATE_STARTED
+	}
+
+	return state
+}
+
+// set set current state of scenario
+func (s *scenarioStates) set(scenario, state string) {
+	s.mu.Lock()
+	s.states[scenario] = state
+	s.mu.Unlock()
+}
+
+// all return copy of map with scenarios states
+func (s *scenarioStates) all() map[string]string {
+	result := make(map[string]string)
+
+	s.mu.RLock()
+
+	for scenario, state := range s.states {
+		result[scenario] = state
+	}
+
+	s.mu.RUnlock()
+
+	return result
+}
+
+// reset reset state of given scenarios (or all scenarios if names is not set)
+func (s *scenarioStates) reset(scenarios ...string) {
+	s.mu.Lock()
+
+	if len(scenarios) == 0 {
+		s.states = make(map[string]string)
+	}
+
+	for _, scenario := range scenarios {
+		delete(s.states, scenario)
+	}
+
+	s.mu.Unlock()
+}
+
+// isFit return true if rule can be used with current scenario state
+func (s *scenarioStates) isFit(rule *Rule) bool {
+	if rule.Scenario == "" || rule.RequiredState == "" {
+		return true
+	}
+
+	return s.get(rule.Scenario) == rule.RequiredState
+}
@@ -0,0 +1,98 @@
+package rules
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Seed is seed for fake data generation
+type Seed struct {
+	Value  int64  // Static seed value
+	Source string // Seed source (query/header/cookie/param/body), empty for static seed
+	Name   string // Query param, header, cookie, named param or JSON path
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// String return string with seed info
+func (s *Seed) String() string {
+	if s == nil {
+		return "Nil"
+	}
+
+	if s.Source == "" {
+		return strconv.FormatInt(s.Value, 10)
+	}
+
+	return s.Source + ":" + s.Name
+}
+
+// Get return seed for given request and request body
+func (s *Seed) Get(r *http.Request, body []byte, params map[string]string) int64 {
+	if s.Source == "" {
+		return s.Value
+	}
+
+	value, _ := getRequestValue(r, body, params, s.Source, s.Name)
+
+	return StringToSeed(s.Source + ":" + s.Name + "=" + value)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// StringToSeed convert string to seed value
+func StringToSeed(data string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(data))
+	return int64(hash.Sum64())
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// parseSeed parse seed from string (number or source:name)
+func parseSeed(data string) (*Seed, error) {
+	data = strings.TrimSpace(data)
+
+	if data == "" {
+		return nil, fmt.Errorf("seed is empty")
+	}
+
+	index := strings.Index(data, ":")
+
+	if index == -1 {
+		value, err := strconv.ParseInt(data, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("seed must be a number or source:name")
+		}
+
+		return &Seed{Value: value}, nil
+	}
+
+	source := strings.ToLower(strings.TrimSpace(data[:index]))
+	name := strings.TrimSpace(data[index+1:])
+
+	switch source {
+	case SOURCE_QUERY, SOURCE_HEADER, SOURCE_COOKIE, SOURCE_PARAM, SOURCE_BODY:
+	default:
+		return nil, fmt.Errorf("unknown seed source %s", source)
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("seed source name is empty")
+	}
+
+	return &Seed{Source: source, Name: name}, nil
+}
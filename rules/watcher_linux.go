@@ -0,0 +1,221 @@
+//go:build linux
+// +build linux
+
+package rules
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"pkg.re/essentialkaos/ek.v3/log"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// WATCH_MASK is mask with inotify events which we want to receive
+const WATCH_MASK = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// watcher is inotify based file system watcher
+type watcher struct {
+	events chan fsEvent // channel with file system events
+
+	fd   int            // inotify instance descriptor
+	file *os.File       // inotify instance file (used for reading and closing)
+	root string         // root watched directory
+	dirs map[int]string // watch descriptor -> dir path
+	mu   sync.Mutex     // lock for dirs map
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// newWatcher create new watcher for given dir and all subdirs
+func newWatcher(dir string) (*watcher, error) {
+	// Non-blocking descriptor is used by runtime poller, so pending
+	// read is interrupted when file is closed
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	w := &watcher{
+		events: make(chan fsEvent, 128),
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		root:   filepath.Clean(dir),
+		dirs:   make(map[int]string),
+	}
+
+	err = w.addDir(w.root)
+
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	go w.read()
+
+	return w, nil
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// close stop watching and close inotify instance
+func (w *watcher) close() error {
+	return w.file.Close()
+}
+
+// addDir add watches for given dir and all subdirs
+func (w *watcher) addDir(dir string) error {
+	return filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		return w.addWatch(file)
+	})
+}
+
+// watchDir add watch for given dir without subdirs (used for dirs with
+// response files placed outside of root dir)
+func (w *watcher) watchDir(dir string) error {
+	dir = filepath.Clean(dir)
+
+	w.mu.Lock()
+
+	for _, watchedDir := range w.dirs {
+		if watchedDir == dir {
+			w.mu.Unlock()
+			return nil
+		}
+	}
+
+	w.mu.Unlock()
+
+	return w.addWatch(dir)
+}
+
+// addWatch add watch for given dir
+func (w *watcher) addWatch(dir string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, WATCH_MASK)
+
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	w.mu.Lock()
+	w.dirs[wd] = dir
+	w.mu.Unlock()
+
+	return nil
+}
+
+// isRootPath return true if given path is root dir or placed inside it
+func (w *watcher) isRootPath(path string) bool {
+	return path == w.root || strings.HasPrefix(path, w.root+"/")
+}
+
+// read read and process events from inotify instance
+func (w *watcher) read() {
+	var buf [syscall.SizeofInotifyEvent * 4096]byte
+
+	for {
+		n, err := w.file.Read(buf[:])
+
+		if isClosedError(err) {
+			close(w.events)
+			return
+		}
+
+		if err != nil || n <= 0 {
+			log.Error("Can't read inotify events: %v", err)
+			close(w.events)
+			return
+		}
+
+		var offset int
+
+		for offset+syscall.SizeofInotifyEvent <= n {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+
+			name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+
+			w.process(int(event.Wd), event.Mask, name)
+
+			offset = nameEnd
+		}
+	}
+}
+
+// process convert inotify event to file system event
+func (w *watcher) process(wd int, mask uint32, name string) {
+	// Some events was lost, so we should check all files
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.events <- fsEvent{Path: w.root, IsDir: true}
+		return
+	}
+
+	w.mu.Lock()
+
+	dir, ok := w.dirs[wd]
+
+	if ok && mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		ok = false
+	}
+
+	w.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if name == "" {
+		return
+	}
+
+	file := filepath.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+
+	// Subdirs of dirs outside of root dir are not watched
+	if isDir && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && w.isRootPath(file) {
+		err := w.addDir(file)
+
+		if err != nil {
+			log.Error("Can't watch directory %s: %v", file, err)
+		}
+	}
+
+	w.events <- fsEvent{Path: file, IsDir: isDir}
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// isClosedError return true if error is caused by reading from closed file
+func isClosedError(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+
+	return err == os.ErrClosed
+}
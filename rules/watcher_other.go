@@ -0,0 +1,39 @@
+//go:build !linux
+// +build !linux
+
+package rules
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"errors"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// watcher is stub for platforms without inotify support
+type watcher struct {
+	events chan fsEvent // channel with file system events
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// newWatcher return error because inotify is not supported on this platform
+func newWatcher(dir string) (*watcher, error) {
+	return nil, errors.New("inotify is not supported on this platform")
+}
+
+// close do nothing, because watcher is not supported on this platform
+func (w *watcher) close() error {
+	return nil
+}
+
+// watchDir do nothing, because watcher is not supported on this platform
+func (w *watcher) watchDir(dir string) error {
+	return nil
+}
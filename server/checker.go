@@ -0,0 +1,103 @@
+package server
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/essentialkaos/mockka/rules"
+	"github.com/essentialkaos/mockka/urlutil"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// stabberType is type of stabber used for checking methods calls
+var stabberType = reflect.TypeOf(&Stabber{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// CheckTemplate check response template for syntax errors, calls of unknown
+// stabber methods and calls with wrong number of arguments
+func CheckTemplate(resp *rules.Response) error {
+	return rules.CheckTemplate(resp, stabberType)
+}
+
+// DryRunTemplate render response template for synthetic request built from
+// rule (errors can be caused by synthetic data, so they are not fatal)
+func DryRunTemplate(rule *rules.Rule, respID string, resp *rules.Response) error {
+	tmpl, err := resp.Template()
+
+	if err != nil {
+		return resp.TemplateError(err)
+	}
+
+	r := makeSyntheticRequest(rule)
+	body, _ := rules.ReadBody(r)
+	params := rule.Request.URLParams(urlutil.SortURLParams(r.URL))
+
+	err = tmpl.Execute(ioutil.Discard, newStabber(r, body, params, rule, respID))
+
+	if err != nil {
+		return resp.TemplateError(err)
+	}
+
+	return nil
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// makeSyntheticRequest create request which fits given rule
+func makeSyntheticRequest(rule *rules.Rule) *http.Request {
+	var body string
+
+	host := rule.Request.Host
+
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	if rule.Request.Body != nil {
+		switch rule.Request.Body.Type {
+		case rules.MATCH_EXACT, rules.MATCH_CONTAINS, rules.MATCH_JSON:
+			body = rule.Request.Body.Content
+		}
+	}
+
+	r, err := http.NewRequest(
+		rule.Request.Method,
+		"http://"+host+urlutil.Sample(rule.Request.URL),
+		strings.NewReader(body),
+	)
+
+	if err != nil {
+		r, _ = http.NewRequest("GET", "http://127.0.0.1/", nil)
+		return r
+	}
+
+	for _, matcher := range rule.Request.Headers {
+		r.Header.Set(matcher.Name, getSampleValue(matcher))
+	}
+
+	for _, matcher := range rule.Request.Cookies {
+		r.AddCookie(&http.Cookie{Name: matcher.Name, Value: getSampleValue(matcher)})
+	}
+
+	return r
+}
+
+// getSampleValue return value which fits given value matcher
+func getSampleValue(matcher *rules.ValueMatcher) string {
+	if matcher.Value == "" || strings.HasPrefix(matcher.Value, "~") {
+		return "1"
+	}
+
+	return matcher.Value
+}
@@ -0,0 +1,69 @@
+package server
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"github.com/essentialkaos/mockka/rules"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+type CheckerSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&CheckerSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *CheckerSuite) TestCheckTemplate(c *C) {
+	checkResponse := func(content string) error {
+		rule, err := rules.ParseContent([]byte(content), "", "service", "", "test")
+
+		c.Assert(err, IsNil)
+
+		return CheckTemplate(rule.Responses[rules.DEFAULT])
+	}
+
+	err := checkResponse("@REQUEST\nPOST /users/{id}\n\n@MATCH-BODY:json\n{\"name\":\"Bob\"}\n\n@RESPONSE\n{\"id\":{{ .Param \"id\" }},\"name\":\"{{ .JSON \"name\" }}\",\"email\":\"{{ .EmailAddress }}\"}\n")
+
+	c.Assert(err, IsNil)
+
+	err = checkResponse("@REQUEST\nGET /users\n\n@RESPONSE\n{{ .EmailAddress \"en\" }}\n")
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "line 5:4: wrong number of args for EmailAddress: want 0 got 1")
+}
+
+func (s *CheckerSuite) TestDryRunTemplate(c *C) {
+	dryRun := func(content string) error {
+		rule, err := rules.ParseContent([]byte(content), "", "service", "", "test")
+
+		c.Assert(err, IsNil)
+
+		return DryRunTemplate(rule, rules.DEFAULT, rule.Responses[rules.DEFAULT])
+	}
+
+	err := dryRun("@REQUEST\nGET /users/{id}\n\n@RESPONSE\n{\"id\":{{ .Param \"id\" }}}\n")
+
+	c.Assert(err, IsNil)
+
+	content := "@REQUEST\nGET /users\n\n@RESPONSE\n{{ index (split (.Query \"x\") \",\") 1 }}\n"
+	rule, err := rules.ParseContent([]byte(content), "", "service", "", "test")
+
+	c.Assert(err, IsNil)
+	c.Assert(CheckTemplate(rule.Responses[rules.DEFAULT]), IsNil)
+
+	err = dryRun(content)
+
+	c.Assert(err, Not(IsNil))
+	c.Assert(err, FitsTypeOf, &rules.PositionError{})
+	c.Assert(err.(*rules.PositionError).Line, Equals, 5)
+}
@@ -0,0 +1,169 @@
+package server
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/essentialkaos/mockka/urlutil"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Journal is bounded in-memory journal of processed requests
+type Journal struct {
+	records []*LogRecord // ring buffer with records
+	next    int          // index for next record
+	full    bool         // buffer is full marker
+	mu      sync.RWMutex // lock for records
+}
+
+// JournalFilter contains conditions for journal records
+type JournalFilter struct {
+	Rule        string    // Rule name (service/dir/mock)
+	Method      string    // Request method
+	URL         string    // Request URL pattern (with wildcards, named params or regexp)
+	Header      string    // Request header name
+	HeaderValue string    // Request header value (empty - any value)
+	Since       time.Time // Minimal request date
+	Until       time.Time // Maximal request date
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// NewJournal create new journal with given max number of records
+func NewJournal(size int) *Journal {
+	if size <= 0 {
+		return nil
+	}
+
+	return &Journal{records: make([]*LogRecord, size)}
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Add add record to journal (the oldest record will be removed if journal is full)
+func (j *Journal) Add(record *LogRecord) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+
+	j.records[j.next] = record
+	j.next++
+
+	if j.next == len(j.records) {
+		j.next, j.full = 0, true
+	}
+
+	j.mu.Unlock()
+}
+
+// Find return all records which fit filter (from oldest to newest)
+func (j *Journal) Find(filter *JournalFilter) []*LogRecord {
+	var result []*LogRecord
+
+	if j == nil {
+		return result
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if j.full {
+		result = appendMatched(result, j.records[j.next:], filter)
+	}
+
+	return appendMatched(result, j.records[:j.next], filter)
+}
+
+// Count return number of records which fit filter
+func (j *Journal) Count(filter *JournalFilter) int {
+	return len(j.Find(filter))
+}
+
+// Reset remove all records from journal
+func (j *Journal) Reset() {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+
+	j.records = make([]*LogRecord, len(j.records))
+	j.next, j.full = 0, false
+
+	j.mu.Unlock()
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Match return true if record fits all filter conditions
+func (f *JournalFilter) Match(record *LogRecord) bool {
+	if f == nil {
+		return true
+	}
+
+	switch {
+	case f.Rule != "" && f.Rule != record.Rule,
+		f.Method != "" && !strings.EqualFold(f.Method, record.Method),
+		!f.Since.IsZero() && record.Date.Before(f.Since),
+		!f.Until.IsZero() && record.Date.After(f.Until):
+		return false
+	}
+
+	if f.URL != "" && !matchURL(f.URL, record.Request) {
+		return false
+	}
+
+	if f.Header != "" && !matchHeader(f.Header, f.HeaderValue, record) {
+		return false
+	}
+
+	return true
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// appendMatched append records which fit filter to result slice
+func appendMatched(result, records []*LogRecord, filter *JournalFilter) []*LogRecord {
+	for _, record := range records {
+		if filter.Match(record) {
+			result = append(result, record)
+		}
+	}
+
+	return result
+}
+
+// matchURL return true if request url fits pattern
+func matchURL(pattern, url string) bool {
+	if !urlutil.IsRegexp(pattern) {
+		pattern = urlutil.SortParams(pattern)
+	}
+
+	return urlutil.Match(pattern, urlutil.SortParams(url))
+}
+
+// matchHeader return true if record contains header with given value
+func matchHeader(name, value string, record *LogRecord) bool {
+	for _, header := range record.RequestHeaders {
+		if !strings.EqualFold(header.Key, name) {
+			continue
+		}
+
+		if value == "" || header.String() == value {
+			return true
+		}
+	}
+
+	return false
+}
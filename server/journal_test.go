@@ -0,0 +1,81 @@
+package server
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"testing"
+	"time"
+
+	"pkg.re/essentialkaos/ek.v3/kv"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func Test(t *testing.T) { TestingT(t) }
+
+type JournalSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&JournalSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *JournalSuite) TestJournal(c *C) {
+	var journal *Journal
+
+	c.Assert(NewJournal(0), IsNil)
+
+	journal.Add(&LogRecord{})
+
+	c.Assert(journal.Find(nil), HasLen, 0)
+
+	journal = NewJournal(3)
+
+	for i := 0; i < 5; i++ {
+		journal.Add(&LogRecord{Method: "GET", Request: "/test", StatusCode: i})
+	}
+
+	records := journal.Find(nil)
+
+	c.Assert(records, HasLen, 3)
+	c.Assert(records[0].StatusCode, Equals, 2)
+	c.Assert(records[2].StatusCode, Equals, 4)
+
+	journal.Reset()
+
+	c.Assert(journal.Count(nil), Equals, 0)
+}
+
+func (s *JournalSuite) TestFilter(c *C) {
+	date := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	journal := NewJournal(10)
+
+	journal.Add(&LogRecord{
+		Date: date, Rule: "test/users", Method: "GET", Request: "/users/1?b=2&a=1",
+		RequestHeaders: []*kv.KV{&kv.KV{Key: "X-Token", Value: "abcd"}},
+	})
+
+	journal.Add(&LogRecord{
+		Date: date.Add(time.Hour), Rule: "test/users", Method: "POST", Request: "/users",
+	})
+
+	c.Assert(journal.Count(&JournalFilter{Rule: "test/users"}), Equals, 2)
+	c.Assert(journal.Count(&JournalFilter{Rule: "test/unknown"}), Equals, 0)
+	c.Assert(journal.Count(&JournalFilter{Method: "post"}), Equals, 1)
+	c.Assert(journal.Count(&JournalFilter{URL: "/users/*"}), Equals, 1)
+	c.Assert(journal.Count(&JournalFilter{URL: "/users/{id}?a=1&b=2"}), Equals, 1)
+	c.Assert(journal.Count(&JournalFilter{URL: "~^/users$"}), Equals, 1)
+	c.Assert(journal.Count(&JournalFilter{Header: "x-token"}), Equals, 1)
+	c.Assert(journal.Count(&JournalFilter{Header: "X-Token", HeaderValue: "abcd"}), Equals, 1)
+	c.Assert(journal.Count(&JournalFilter{Header: "X-Token", HeaderValue: "1234"}), Equals, 0)
+	c.Assert(journal.Count(&JournalFilter{Since: date.Add(time.Minute)}), Equals, 1)
+	c.Assert(journal.Count(&JournalFilter{Until: date.Add(time.Minute)}), Equals, 1)
+}
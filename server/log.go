@@ -22,6 +22,8 @@ import (
 type LogRecord struct {
 	Date            time.Time `json:"date"`
 	Mock            string    `json:"mock"`
+	Rule            string    `json:"rule"`
+	Processing      string    `json:"processing"`
 	RemoteAdress    string    `json:"remote_adress"`
 	RequestHost     string    `json:"request_host"`
 	Method          string    `json:"method"`
@@ -52,7 +54,11 @@ func (lr *LogRecord) Write(file string) error {
 	date := timeutil.Format(lr.Date, "%Y/%m/%d %T")
 
 	fmt.Fprintf(fd, "-- %s -----------------------------------------------------------------\n\n", date)
-	fmt.Fprintf(fd, "  %-24s %s\n", "Mock:", lr.Mock)
+	if lr.Mock != "" {
+		fmt.Fprintf(fd, "  %-24s %s\n", "Mock:", lr.Mock)
+	}
+
+	fmt.Fprintf(fd, "  %-24s %s\n", "Processing:", lr.Processing)
 
 	if lr.RemoteAdress != "" {
 		fmt.Fprintf(fd, "  %-24s %s\n", "Remote Adress:", lr.RemoteAdress)
@@ -0,0 +1,289 @@
+package server
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg.re/essentialkaos/ek.v3/fsutil"
+	"pkg.re/essentialkaos/ek.v3/httputil"
+	"pkg.re/essentialkaos/ek.v3/knf"
+	"pkg.re/essentialkaos/ek.v3/log"
+	"pkg.re/essentialkaos/ek.v3/path"
+	"pkg.re/essentialkaos/ek.v3/timeutil"
+
+	"github.com/essentialkaos/mockka/urlutil"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// recorder is reverse proxy which save all proxied requests as mock files
+type recorder struct {
+	service  string          // Service name
+	upstream string          // Upstream URL
+	ruleDir  string          // Path to directory with rules
+	recorded map[string]bool // method+url -> recorded flag
+	mu       sync.Mutex      // lock for recorded map
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// skipHeaders contains response headers which will not be saved to mock file
+//
+// Mock file can contain only one value for every header and values of
+// Set-Cookie header can't be combined, so cookies are not recorded
+var skipHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Date":              true,
+	"Keep-Alive":        true,
+	"Server":            true,
+	"Set-Cookie":        true,
+	"Transfer-Encoding": true,
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// StartRecorder starts mockka HTTP server in record mode
+func StartRecorder(service, upstream, customPort string) error {
+	if service == "" || strings.Contains(service, "/") {
+		return errors.New("You must define service name (service1 for example)")
+	}
+
+	if !httputil.IsURL(upstream) {
+		return fmt.Errorf("Upstream %s is not valid URL", upstream)
+	}
+
+	if !fsutil.IsWritable(knf.GetS(DATA_RULE_DIR)) {
+		return fmt.Errorf("Directory %s must be writable.", knf.GetS(DATA_RULE_DIR))
+	}
+
+	rec := &recorder{
+		service:  service,
+		upstream: strings.TrimRight(upstream, "/"),
+		ruleDir:  knf.GetS(DATA_RULE_DIR),
+		recorded: make(map[string]bool),
+	}
+
+	log.Aux("Recording requests to %s as mocks for service %s\n", rec.upstream, service)
+
+	return listen(rec.handler, customPort)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// handler proxy request to upstream and save response as mock file
+func (rec *recorder) handler(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Request: %s → %s%v", r.Method, r.Host, r.URL)
+
+	respData, content, _, err := forwardRequest(r, rec.upstream)
+
+	if err != nil {
+		log.Error("Can't proxy request: %v", err)
+		writeError(w, r, X_MOCKKA_CANT_PROXY)
+		return
+	}
+
+	rec.record(r, respData.StatusCode, respData.Header, content)
+
+	writeUpstreamResponse(w, respData, content)
+}
+
+// record save response as mock file if request with same method and url
+// wasn't recorded before
+func (rec *recorder) record(r *http.Request, code int, headers http.Header, content string) {
+	uri := urlutil.SortURLParams(r.URL)
+	key := r.Method + ":" + uri
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.recorded[key] {
+		return
+	}
+
+	rec.recorded[key] = true
+
+	name := getRecordName(r.Method, r.URL)
+	err := rec.writeMock(name, r.Method, getRecordURI(r.URL), code, headers, content)
+
+	if err != nil {
+		log.Error("Can't save mock for request %s %s: %v", r.Method, uri, err)
+		return
+	}
+
+	log.Info("Request %s %s saved as %s", r.Method, uri, path.Join(rec.service, name))
+}
+
+// writeMock create mock file and file with response body
+func (rec *recorder) writeMock(name, method, uri string, code int, headers http.Header, content string) error {
+	serviceDir := path.Join(rec.ruleDir, rec.service)
+	mockFile := path.Join(serviceDir, name+".mock")
+
+	if fsutil.IsExist(mockFile) {
+		return fmt.Errorf("File %s already exist", mockFile)
+	}
+
+	if !fsutil.IsExist(serviceDir) {
+		err := os.MkdirAll(serviceDir, 0755)
+
+		if err != nil {
+			return fmt.Errorf("Can't create directory %s", serviceDir)
+		}
+
+		updatePerms(serviceDir, knf.GetM(ACCESS_MOCK_DIR_PERMS, 0775))
+	}
+
+	var bodyFile string
+
+	if content != "" {
+		bodyFile = name + getBodyExt(headers.Get("Content-Type"))
+
+		// Response body is template, so we must escape template actions
+		content = strings.Replace(content, "{{", "{{\"{{\"}}", -1)
+
+		err := writeRecordFile(path.Join(serviceDir, bodyFile), content)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeRecordFile(mockFile, rec.renderMock(method, uri, code, headers, bodyFile))
+}
+
+// renderMock return mock file content
+func (rec *recorder) renderMock(method, uri string, code int, headers http.Header, bodyFile string) string {
+	var bf bytes.Buffer
+
+	bf.WriteString("@DESCRIPTION\n")
+	bf.WriteString(fmt.Sprintf(
+		"Recorded from %s at %s\n\n", rec.upstream,
+		timeutil.Format(time.Now(), "%Y/%m/%d %H:%M:%S"),
+	))
+
+	bf.WriteString("@REQUEST\n")
+	bf.WriteString(method + " " + uri + "\n\n")
+
+	if bodyFile != "" {
+		bf.WriteString("@RESPONSE < " + bodyFile + "\n\n")
+	}
+
+	bf.WriteString("@CODE\n")
+	bf.WriteString(fmt.Sprintf("%d\n", code))
+
+	var names []string
+
+	for name := range headers {
+		if !skipHeaders[name] && headers.Get(name) != "" {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) != 0 {
+		sort.Strings(names)
+
+		bf.WriteString("\n@HEADERS\n")
+
+		// Multiple values of the same header are combined into one
+		// comma-separated value (RFC 7230, section 3.2.2)
+		for _, name := range names {
+			bf.WriteString(name + ":" + strings.Join(headers[name], ", ") + "\n")
+		}
+	}
+
+	return bf.String()
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// writeRecordFile write data to file and update file permissions
+func writeRecordFile(file, data string) error {
+	err := ioutil.WriteFile(file, []byte(data), 0644)
+
+	if err != nil {
+		return fmt.Errorf("Can't create file %s", file)
+	}
+
+	updatePerms(file, knf.GetM(ACCESS_MOCK_PERMS, 0664))
+
+	return nil
+}
+
+// getRecordName return name of mock file for request
+func getRecordName(method string, u *url.URL) string {
+	var lossy bool
+
+	name := strings.Trim(u.Path, "/")
+
+	if name == "" {
+		name = "index"
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r != '/':
+			lossy = true
+		}
+
+		return '-'
+	}, name)
+
+	name = strings.ToLower(method) + "-" + name
+
+	// Requests with different query must be saved to different files, also
+	// paths with replaced symbols (/a-b and /a/b) must not have the same name
+	if u.RawQuery != "" || lossy {
+		hash := fnv.New32a()
+		hash.Write([]byte(urlutil.SortURLParams(u)))
+		name += fmt.Sprintf("-%08x", hash.Sum32())
+	}
+
+	return name
+}
+
+// getRecordURI return request URI with sorted and escaped query params
+// for REQUEST section
+func getRecordURI(u *url.URL) string {
+	query := u.Query()
+
+	if len(query) == 0 {
+		return u.RequestURI()
+	}
+
+	return u.EscapedPath() + "?" + query.Encode()
+}
+
+// getBodyExt return extension of file with response body for given content type
+func getBodyExt(contentType string) string {
+	switch {
+	case strings.Contains(contentType, "json"), strings.Contains(contentType, "javascript"):
+		return ".json"
+	case strings.Contains(contentType, "xml"):
+		return ".xml"
+	case strings.Contains(contentType, "html"):
+		return ".html"
+	case strings.Contains(contentType, "csv"):
+		return ".csv"
+	}
+
+	return ".txt"
+}
@@ -0,0 +1,110 @@
+package server
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/essentialkaos/mockka/rules"
+	"github.com/essentialkaos/mockka/urlutil"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+type RecorderSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&RecorderSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *RecorderSuite) TestRecordName(c *C) {
+	u1, _ := url.Parse("http://127.0.0.1/a/b")
+	u2, _ := url.Parse("http://127.0.0.1/a-b")
+	u3, _ := url.Parse("http://127.0.0.1/")
+
+	c.Assert(getRecordName("GET", u1), Equals, "get-a-b")
+	c.Assert(getRecordName("GET", u2), Matches, "get-a-b-[0-9a-f]{8}")
+	c.Assert(getRecordName("GET", u3), Equals, "get-index")
+}
+
+func (s *RecorderSuite) TestRecordURI(c *C) {
+	u, _ := url.Parse("http://127.0.0.1/users?name=John%20Doe&debug&id=1")
+
+	uri := getRecordURI(u)
+
+	c.Assert(uri, Equals, "/users?debug=&id=1&name=John+Doe")
+
+	rule, err := rules.ParseContent([]byte("@REQUEST\nGET "+uri+"\n\n@RESPONSE\nok\n"), "", "service", "", "test")
+
+	c.Assert(err, IsNil)
+	c.Assert(rule.Request.NURL, Equals, urlutil.SortURLParams(u))
+
+	u, _ = url.Parse("http://127.0.0.1/users")
+
+	c.Assert(getRecordURI(u), Equals, "/users")
+}
+
+func (s *RecorderSuite) TestRecording(c *C) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Add("Vary", "Accept")
+		w.Header().Add("Vary", "Cookie")
+		w.Header().Add("Set-Cookie", "session=abcd; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Add("Set-Cookie", "lang=en")
+		w.WriteHeader(201)
+		w.Write([]byte(`{"id":1,"tmpl":"{{"}`))
+	}))
+
+	defer upstream.Close()
+
+	rec := &recorder{
+		service:  "service",
+		upstream: upstream.URL,
+		ruleDir:  c.MkDir(),
+		recorded: make(map[string]bool),
+	}
+
+	r := httptest.NewRequest("GET", "/users?name=John%20Doe&id=1", nil)
+	w := httptest.NewRecorder()
+
+	rec.handler(w, r)
+
+	c.Assert(w.Code, Equals, 201)
+	c.Assert(w.Header()["Set-Cookie"], HasLen, 2)
+
+	rule, err := rules.Parse(rec.ruleDir, "service", "", getRecordName("GET", r.URL))
+
+	c.Assert(err, IsNil)
+	c.Assert(rule.Request.Method, Equals, "GET")
+	c.Assert(rule.Request.NURL, Equals, urlutil.SortURLParams(r.URL))
+
+	resp := rule.Responses[rules.DEFAULT]
+
+	c.Assert(resp, Not(IsNil))
+	c.Assert(resp.Code, Equals, 201)
+	c.Assert(resp.Headers, DeepEquals, map[string]string{
+		"Content-Type": "application/json",
+		"Vary":         "Accept, Cookie",
+	})
+
+	tmpl, err := resp.Template()
+
+	c.Assert(err, IsNil)
+
+	var body bytes.Buffer
+
+	c.Assert(tmpl.Execute(&body, nil), IsNil)
+	c.Assert(body.String(), Equals, `{"id":1,"tmpl":"{{"}`)
+}
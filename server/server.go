@@ -15,7 +15,6 @@ import (
 	"os"
 	"sort"
 	"strings"
-	"text/template"
 	"time"
 
 	"pkg.re/essentialkaos/ek.v3/crypto"
@@ -26,11 +25,11 @@ import (
 	"pkg.re/essentialkaos/ek.v3/log"
 	"pkg.re/essentialkaos/ek.v3/mathutil"
 	"pkg.re/essentialkaos/ek.v3/path"
-	"pkg.re/essentialkaos/ek.v3/rand"
 	"pkg.re/essentialkaos/ek.v3/req"
 	"pkg.re/essentialkaos/ek.v3/system"
 
 	"github.com/essentialkaos/mockka/rules"
+	"github.com/essentialkaos/mockka/urlutil"
 )
 
 // ////////////////////////////////////////////////////////////////////////////////// //
@@ -42,11 +41,21 @@ const (
 	X_MOCKKA_CANT_RENDER = 3
 	X_MOCKKA_CANT_PROXY  = 4
 	X_MOCKKA_FORBIDDEN   = 5
+	X_MOCKKA_CANT_READ   = 6
 )
 
 const ERROR_HTTP_CODE = 599
 
+// FALLBACK_LOG is name of log file for requests passed through to fallback upstream
+const FALLBACK_LOG = "_fallback"
+
 const (
+	PROCESSING_MOCKED      = "mocked"
+	PROCESSING_PASSTHROUGH = "passed through"
+)
+
+const (
+	DATA_RULE_DIR             = "data:rule-dir"
 	DATA_LOG_DIR              = "data:log-dir"
 	DATA_LOG_TYPE             = "data:log-type"
 	HTTP_IP                   = "http:ip"
@@ -56,6 +65,8 @@ const (
 	HTTP_MAX_HEADER_SIZE      = "http:max-header-size"
 	HTTP_MAX_DELAY            = "http:max-delay"
 	PROCESSING_ALLOW_PROXYING = "processing:allow-proxying"
+	PROCESSING_FALLBACK       = "processing:fallback-upstream"
+	PROCESSING_FAKE_SEED      = "processing:fake-seed"
 	ACCESS_USER               = "access:user"
 	ACCESS_GROUP              = "access:group"
 	ACCESS_MOCK_PERMS         = "access:mock-perms"
@@ -66,11 +77,25 @@ const (
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
-var (
-	serverToken string
-	observer    *rules.Observer
-	stabber     *Stabber
-)
+// Config contains server configuration
+type Config struct {
+	ServerToken      string  // Value of Server header
+	AllowProxying    bool    // Allow request proxying
+	FallbackUpstream string  // URL for requests without rules
+	MaxDelay         float64 // Max response delay in seconds
+	LogDir           string  // Path to directory with logs (empty - logging disabled)
+	LogType          string  // Logging type (united/separated)
+	FakeSeed         int64   // Seed for fake data generation (0 - random data)
+}
+
+// Handler is HTTP handler which process requests with rules from observer
+type Handler struct {
+	observer *rules.Observer
+	journal  *Journal
+	config   *Config
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
 
 var errorDesc = map[int]string{
 	X_MOCKKA_NO_RULE:     "RuleNotFound",
@@ -78,20 +103,45 @@ var errorDesc = map[int]string{
 	X_MOCKKA_CANT_RENDER: "CantRenderTemplate",
 	X_MOCKKA_CANT_PROXY:  "CantProxyRequest",
 	X_MOCKKA_FORBIDDEN:   "ForbidenAction",
+	X_MOCKKA_CANT_READ:   "CantReadRequestBody",
 }
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 // Start starts mockka HTTP server
-func Start(obs *rules.Observer, serverName, customPort string) error {
+func Start(obs *rules.Observer, jrn *Journal, serverName, customPort string) error {
 	if obs == nil {
 		return errors.New("Observer is not created")
 	}
 
-	observer = obs
-	serverToken = serverName
-	stabber = &Stabber{}
+	config := &Config{
+		ServerToken:      serverName,
+		AllowProxying:    knf.GetB(PROCESSING_ALLOW_PROXYING),
+		FallbackUpstream: knf.GetS(PROCESSING_FALLBACK),
+		MaxDelay:         knf.GetF(HTTP_MAX_DELAY, 60.0),
+		LogDir:           knf.GetS(DATA_LOG_DIR),
+		LogType:          knf.GetS(DATA_LOG_TYPE, "united"),
+		FakeSeed:         int64(knf.GetI(PROCESSING_FAKE_SEED)),
+	}
+
+	return listen(NewHandler(obs, jrn, config).ServeHTTP, customPort)
+}
+
+// NewHandler create new handler
+func NewHandler(obs *rules.Observer, jrn *Journal, config *Config) *Handler {
+	if config == nil {
+		config = &Config{MaxDelay: 60.0}
+	}
 
+	return &Handler{
+		observer: obs,
+		journal:  jrn,
+		config:   config,
+	}
+}
+
+// listen create HTTP server with given handler and start listening
+func listen(handler http.HandlerFunc, customPort string) error {
 	port := knf.GetS(HTTP_PORT)
 
 	if customPort != "" {
@@ -106,28 +156,45 @@ func Start(obs *rules.Observer, serverName, customPort string) error {
 		MaxHeaderBytes: knf.GetI(HTTP_MAX_HEADER_SIZE),
 	}
 
-	server.Handler.(*http.ServeMux).HandleFunc("/", basicHandler)
+	server.Handler.(*http.ServeMux).HandleFunc("/", handler)
 
 	log.Aux("Mockka HTTP server started on %s:%s\n", knf.GetS(HTTP_IP), port)
 
 	return server.ListenAndServe()
 }
 
-// basicHandler is handler for all requests
-func basicHandler(w http.ResponseWriter, r *http.Request) {
+// ServeHTTP is handler for all requests
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var (
-		err  error
-		rule *rules.Rule
-		resp *rules.Response
+		err    error
+		rule   *rules.Rule
+		resp   *rules.Response
+		respID string
 	)
 
 	uuid := crypto.GenUUID()
 
 	log.Debug("Request: %s → %s%v (%s)", r.Method, r.Host, r.URL, uuid)
 
-	w.Header().Set("Server", serverToken)
+	if h.config.ServerToken != "" {
+		w.Header().Set("Server", h.config.ServerToken)
+	}
+
+	// Body is read once and used by all request matchers and conditions
+	body, err := rules.ReadBody(r)
 
-	rule = observer.GetRule(r)
+	if err != nil {
+		log.Warn("Can't read body of request %s → %s%s: %v", r.Method, r.Host, r.URL.String(), err)
+		writeError(w, r, X_MOCKKA_CANT_READ)
+		return
+	}
+
+	rule = h.observer.GetRule(r, body)
+
+	if rule == nil && h.config.FallbackUpstream != "" {
+		h.fallback(w, r, h.config.FallbackUpstream)
+		return
+	}
 
 	if rule == nil {
 		log.Error("Can't find rule for request %s → %s%s", r.Method, r.Host, r.URL.String())
@@ -135,15 +202,13 @@ func basicHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch len(rule.Responses) {
-	case 0:
+	params := rule.Request.URLParams(urlutil.SortURLParams(r.URL))
+	respID, resp = rule.SelectResponse(r, body, params)
+
+	if resp == nil {
 		log.Error("Can't find rule for request %s → %s%s", r.Method, r.Host, r.URL.String())
 		writeError(w, r, X_MOCKKA_NO_RESPONSE)
 		return
-	case 1:
-		resp = rule.Responses[rules.DEFAULT]
-	default:
-		resp = getRandomResponse(rule)
 	}
 
 	var responseContent string
@@ -151,7 +216,13 @@ func basicHandler(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != "HEAD" {
 		if resp.URL == "" {
-			responseContent, err = renderTemplate(r, resp.Body())
+			stabber := newStabber(r, body, params, rule, respID)
+
+			if seed, ok := h.getFakeSeed(r, rule, body, params); ok {
+				stabber.setSeed(seed)
+			}
+
+			responseContent, err = renderTemplate(stabber, resp)
 
 			if err != nil {
 				log.Error("Can't render response body: %v", err)
@@ -159,7 +230,7 @@ func basicHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		} else {
-			if !knf.GetB(PROCESSING_ALLOW_PROXYING) {
+			if !h.config.AllowProxying {
 				log.Error("Can't proxy request: proxying disabled in configuration file")
 				writeError(w, r, X_MOCKKA_FORBIDDEN)
 				return
@@ -179,12 +250,40 @@ func basicHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("<%s:REQ>  → %v", uuid, rule.Request)
 	log.Debug("<%s:RESP> → %v", uuid, resp)
 
-	logRequestInfo(r, rule, resp, responseContent, bodyData)
-	processRequest(w, r, rule, resp, responseContent)
+	h.logRequestInfo(r, rule, resp, responseContent, bodyData)
+
+	if h.processRequest(w, r, rule, resp, responseContent) {
+		h.observer.ApplyNewState(rule)
+	}
 }
 
-// processRequest process http request and use found rule for formating output data
-func processRequest(w http.ResponseWriter, r *http.Request, rule *rules.Rule, resp *rules.Response, responseContent string) {
+// fallback pass request without rule through to fallback upstream
+func (h *Handler) fallback(w http.ResponseWriter, r *http.Request, upstream string) {
+	upstream = strings.TrimRight(upstream, "/")
+
+	log.Debug("Request %s → %s%s passed through to %s", r.Method, r.Host, r.URL.String(), upstream)
+
+	respData, content, body, err := forwardRequest(r, upstream)
+
+	if err != nil {
+		log.Error("Can't pass request through to %s: %v", upstream, err)
+		writeError(w, r, X_MOCKKA_CANT_PROXY)
+		return
+	}
+
+	resp := &rules.Response{
+		URL:     upstream + r.URL.RequestURI(),
+		Code:    respData.StatusCode,
+		Headers: headersToMap(respData.Header),
+	}
+
+	h.logRequestInfo(r, nil, resp, content, body)
+	writeUpstreamResponse(w, respData, content)
+}
+
+// processRequest process http request and use found rule for formating output data,
+// return true if response was successfully sent
+func (h *Handler) processRequest(w http.ResponseWriter, r *http.Request, rule *rules.Rule, resp *rules.Response, responseContent string) bool {
 	var defResp *rules.Response
 	var headers map[string]string
 	var ok bool
@@ -196,7 +295,7 @@ func processRequest(w http.ResponseWriter, r *http.Request, rule *rules.Rule, re
 
 		if !hasAuth || login != rule.Auth.User || password != rule.Auth.Password {
 			w.WriteHeader(401)
-			return
+			return false
 		}
 	}
 
@@ -221,7 +320,7 @@ func processRequest(w http.ResponseWriter, r *http.Request, rule *rules.Rule, re
 	}
 
 	if resp.Delay > 0 {
-		delay := mathutil.BetweenF(resp.Delay, 0.0, knf.GetF(HTTP_MAX_DELAY, 60.0)) * float64(time.Second)
+		delay := mathutil.BetweenF(resp.Delay, 0.0, h.config.MaxDelay) * float64(time.Second)
 		time.Sleep(time.Duration(delay))
 	}
 
@@ -230,13 +329,29 @@ func processRequest(w http.ResponseWriter, r *http.Request, rule *rules.Rule, re
 	}
 
 	w.WriteHeader(code)
-	w.Write([]byte(responseContent))
+
+	_, err := w.Write([]byte(responseContent))
+
+	if err != nil {
+		log.Error("Can't send response: %v", err)
+		return false
+	}
+
+	return true
 }
 
 // logRequestInfo create log file and write record with info about request and reponse
 // into this file
-func logRequestInfo(req *http.Request, rule *rules.Rule, resp *rules.Response, responseContent string, bodyData []byte) {
-	logPath, err := getLogStore(rule)
+func (h *Handler) logRequestInfo(req *http.Request, rule *rules.Rule, resp *rules.Response, responseContent string, bodyData []byte) {
+	record := makeLogRecord(req, rule, resp, responseContent, bodyData)
+
+	h.journal.Add(record)
+
+	if h.config.LogDir == "" {
+		return
+	}
+
+	logPath, err := h.getLogStore(rule)
 
 	if err != nil {
 		log.Error(err.Error())
@@ -245,7 +360,7 @@ func logRequestInfo(req *http.Request, rule *rules.Rule, resp *rules.Response, r
 
 	requredPermChange := !fsutil.IsExist(logPath)
 
-	err = makeLogRecord(req, rule, resp, responseContent, bodyData).Write(logPath)
+	err = record.Write(logPath)
 
 	if err != nil {
 		log.Error(err.Error())
@@ -257,49 +372,61 @@ func logRequestInfo(req *http.Request, rule *rules.Rule, resp *rules.Response, r
 	}
 }
 
-// renderTemplate render output body template
-func renderTemplate(req *http.Request, responseContent string) (string, error) {
-	templ, err := template.New("").Parse(responseContent)
+// getFakeSeed return seed for fake data generation for given request
+func (h *Handler) getFakeSeed(r *http.Request, rule *rules.Rule, body []byte, params map[string]string) (int64, bool) {
+	if rule.Seed != nil {
+		return rule.Seed.Get(r, body, params), true
+	}
 
-	if err != nil {
-		return "", err
+	if h.config.FakeSeed == 0 {
+		return 0, false
 	}
 
-	var bf bytes.Buffer
+	// Global seed is mixed with request info, so the same request always
+	// gets the same data, but different requests get different data
+	return h.config.FakeSeed ^ rules.StringToSeed(r.Method+" "+r.URL.RequestURI()), true
+}
 
-	stabber.request = req
-	ct := template.Must(templ, nil)
-	err = ct.Execute(&bf, stabber)
-	stabber.request = nil
+// renderTemplate render response body template
+func renderTemplate(stabber *Stabber, resp *rules.Response) (string, error) {
+	templ, err := resp.Template()
 
 	if err != nil {
 		return "", err
 	}
 
-	return bf.String(), nil
-}
-
-// getRandomResponse return random response from list of possible response bodies or default
-// if response only one
-func getRandomResponse(rule *rules.Rule) *rules.Response {
-	var ids []string
+	// Template with seeded random helpers is cloned, because parsed
+	// template is shared between requests
+	if funcs := stabber.randFuncs(); funcs != nil {
+		templ, err = templ.Clone()
 
-	for id := range rule.Responses {
-		if id == rules.DEFAULT {
-			continue
+		if err != nil {
+			return "", err
 		}
 
-		ids = append(ids, id)
+		templ.Funcs(funcs)
+	}
+
+	var bf bytes.Buffer
+
+	err = templ.Execute(&bf, stabber)
+
+	if err != nil {
+		return "", err
 	}
 
-	return rule.Responses[ids[rand.Int(len(ids)-1)]]
+	return bf.String(), nil
 }
 
 // makeLogRecord create log record struct
 func makeLogRecord(req *http.Request, rule *rules.Rule, resp *rules.Response, responseContent string, bodyData []byte) *LogRecord {
-	record := &LogRecord{Date: time.Now()}
+	record := &LogRecord{Date: time.Now(), Processing: PROCESSING_PASSTHROUGH}
 
-	record.Mock = rule.Path
+	if rule != nil {
+		record.Mock = rule.Path
+		record.Rule = rule.PrettyPath
+		record.Processing = PROCESSING_MOCKED
+	}
 
 	xForwardedFor := req.Header.Get("X-Forwarded-For")
 	xRealIP := req.Header.Get("X-Real-Ip")
@@ -313,7 +440,7 @@ func makeLogRecord(req *http.Request, rule *rules.Rule, resp *rules.Response, re
 		record.RemoteAdress = req.RemoteAddr
 	}
 
-	if rule.Request.Host != "" {
+	if rule != nil && rule.Request.Host != "" {
 		record.RequestHost = rule.Request.Host
 	}
 
@@ -325,10 +452,12 @@ func makeLogRecord(req *http.Request, rule *rules.Rule, resp *rules.Response, re
 	record.StatusCode = 200
 
 	if resp.Code == 0 {
-		defResp, ok := rule.Responses[rules.DEFAULT]
+		if rule != nil {
+			defResp, ok := rule.Responses[rules.DEFAULT]
 
-		if ok && defResp.Code != 0 {
-			record.StatusCode = defResp.Code
+			if ok && defResp.Code != 0 {
+				record.StatusCode = defResp.Code
+			}
 		}
 	} else {
 		record.StatusCode = resp.Code
@@ -378,9 +507,13 @@ func makeLogRecord(req *http.Request, rule *rules.Rule, resp *rules.Response, re
 }
 
 // getLogStore create directory for log file and return full path to log
-func getLogStore(rule *rules.Rule) (string, error) {
-	if knf.GetS(DATA_LOG_TYPE, "united") == "united" {
-		return path.Join(knf.GetS(DATA_LOG_DIR), rule.Service+".log"), nil
+func (h *Handler) getLogStore(rule *rules.Rule) (string, error) {
+	if rule == nil {
+		return path.Join(h.config.LogDir, FALLBACK_LOG+".log"), nil
+	}
+
+	if h.config.LogType != "separated" {
+		return path.Join(h.config.LogDir, rule.Service+".log"), nil
 	}
 
 	logDir := path.Join(rule.Service, rule.Dir)
@@ -388,7 +521,7 @@ func getLogStore(rule *rules.Rule) (string, error) {
 
 	for i := 1; i < len(logDirSlice)+1; i++ {
 		pathPart := path.Join(logDirSlice[0:i]...)
-		logDirPath := path.Join(knf.GetS(DATA_LOG_DIR), pathPart)
+		logDirPath := path.Join(h.config.LogDir, pathPart)
 
 		if fsutil.IsExist(logDirPath) {
 			continue
@@ -403,7 +536,7 @@ func getLogStore(rule *rules.Rule) (string, error) {
 		updatePerms(logDirPath, knf.GetM(ACCESS_LOG_DIR_PERMS, 0775))
 	}
 
-	return path.Join(knf.GetS(DATA_LOG_DIR), logDir, rule.Name+".log"), nil
+	return path.Join(h.config.LogDir, logDir, rule.Name+".log"), nil
 }
 
 // updatePerms change permissions for log file/dir
@@ -438,7 +571,7 @@ func getSortedRespHeaders(headers map[string]string) []*kv.KV {
 	var result []*kv.KV
 
 	for n, v := range headers {
-		result = append(result, &kv.KV{n, v})
+		result = append(result, &kv.KV{Key: n, Value: v})
 	}
 
 	kv.Sort(result)
@@ -451,7 +584,7 @@ func getSortedValues(data map[string][]string) []*kv.KV {
 	var result []*kv.KV
 
 	for n, v := range data {
-		result = append(result, &kv.KV{n, strings.Join(v, " ")})
+		result = append(result, &kv.KV{Key: n, Value: strings.Join(v, " ")})
 	}
 
 	kv.Sort(result)
@@ -480,14 +613,81 @@ func writeError(w http.ResponseWriter, r *http.Request, code int) {
 
 // proxyRequest used for proxying request
 func proxyRequest(r *http.Request, rule *rules.Rule, resp *rules.Response) (string, []byte, *rules.Response, error) {
+	request, body, err := makeProxyRequest(r, rule.Request.Method, resp.URL)
+
+	if err != nil {
+		return "", nil, resp, err
+	}
+
+	respData, err := request.Do()
+
+	if err != nil {
+		return "", nil, resp, err
+	}
+
+	resultResp := resp
+
+	// If overwrite flag set for response, we return headers and
+	// status code from proxied request
+	if resp.Overwrite {
+		resultResp = &rules.Response{
+			Delay:   resp.Delay,
+			Code:    respData.StatusCode,
+			Headers: headersToMap(respData.Header),
+		}
+	}
+
+	return respData.String(), body, resultResp, nil
+}
+
+// forwardRequest send request to upstream with same method and url and
+// return upstream response, response body and request body
+func forwardRequest(r *http.Request, upstream string) (*req.Response, string, []byte, error) {
+	request, body, err := makeProxyRequest(r, r.Method, upstream+r.URL.RequestURI())
+
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// Transport decode compressed response only if it set Accept-Encoding
+	// header by itself, but we need plain response body
+	delete(request.Headers, "Accept-Encoding")
+
+	respData, err := request.Do()
+
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return respData, respData.String(), body, nil
+}
+
+// writeUpstreamResponse write response from upstream to client
+func writeUpstreamResponse(w http.ResponseWriter, respData *req.Response, content string) {
+	for name, values := range respData.Header {
+		if name == "Content-Length" || name == "Transfer-Encoding" || name == "Connection" {
+			continue
+		}
+
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+
+	w.WriteHeader(respData.StatusCode)
+	w.Write([]byte(content))
+}
+
+// makeProxyRequest create request with headers and body from initial request
+func makeProxyRequest(r *http.Request, method, url string) (*req.Request, []byte, error) {
 	var (
 		err  error
 		body []byte
 	)
 
-	request := req.Request{
-		Method: rule.Request.Method,
-		URL:    resp.URL,
+	request := &req.Request{
+		Method: method,
+		URL:    url,
 	}
 
 	// Append headers from initial request
@@ -508,31 +708,13 @@ func proxyRequest(r *http.Request, rule *rules.Rule, resp *rules.Response) (stri
 		body, err = ioutil.ReadAll(r.Body)
 
 		if err != nil {
-			return "", nil, resp, err
+			return nil, nil, err
 		}
 
 		request.Body = body
 	}
 
-	respData, err := request.Do()
-
-	if err != nil {
-		return "", nil, resp, err
-	}
-
-	resultResp := resp
-
-	// If overwrite flag set for response, we return headers and
-	// status code from proxied request
-	if resp.Overwrite {
-		resultResp = &rules.Response{
-			Delay:   resp.Delay,
-			Code:    respData.StatusCode,
-			Headers: headersToMap(respData.Header),
-		}
-	}
-
-	return respData.String(), body, resultResp, nil
+	return request, body, nil
 }
 
 // headersToMap convert headers to map with strings
@@ -8,23 +8,79 @@ package server
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/icrowley/fake"
+
+	"github.com/essentialkaos/mockka/rules"
+	"github.com/essentialkaos/mockka/tmplutil"
+	"github.com/essentialkaos/mockka/xmlutil"
 )
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
-// Stabber struct
+// DEFAULT_FAKE_LANG is language used by fake package by default
+const DEFAULT_FAKE_LANG = "en"
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Stabber is template data for one request
 type Stabber struct {
-	request *http.Request
+	request    *http.Request     // Processed request
+	params     map[string]string // Named params from request URL
+	rule       *rules.Rule       // Rule used for request processing
+	responseID string            // Response id
+
+	body      []byte          // Request body
+	form      url.Values      // Cached form values from request body
+	multipart url.Values      // Cached multipart fields (file fields contain file names)
+	json      interface{}     // Cached decoded JSON body
+	xml       *xmlutil.Node   // Cached parsed XML body
+	parsed    map[string]bool // Body parsing markers
+
+	seed   int64      // Seed for fake data generation
+	seeded bool       // Seed usage marker
+	rand   *rand.Rand // Random source for fake package seeds
 }
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
-// Last used fake language
-var stabberFakeLang = "en"
+// fakeLock is lock for fake package calls (fake package use global
+// state for current language and random source), calls without seed
+// share lock while language is not changed
+var fakeLock sync.RWMutex
+
+// fakeLang is language currently used by fake package
+var fakeLang = DEFAULT_FAKE_LANG
+
+// fakeSeeds is random source used for restoring fake package random
+// source after calls with seed
+var fakeSeeds = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// newStabber create new stabber for given request and request body (body
+// can be read by rules.ReadBody)
+func newStabber(r *http.Request, body []byte, params map[string]string, rule *rules.Rule, responseID string) *Stabber {
+	return &Stabber{
+		request:    r,
+		body:       body,
+		params:     params,
+		rule:       rule,
+		responseID: responseID,
+	}
+}
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
@@ -60,529 +116,757 @@ func (s *Stabber) HeaderIs(name, value string) bool {
 	return s.Header(name) == value
 }
 
+// Param return named param value from request url
+func (s *Stabber) Param(name string) string {
+	if s.params == nil {
+		return ""
+	}
+
+	return s.params[name]
+}
+
+// RuleName return name of rule (service/dir/mock) used for request processing
+func (s *Stabber) RuleName() string {
+	if s.rule == nil {
+		return ""
+	}
+
+	return s.rule.PrettyPath
+}
+
+// ResponseID return id of response which is rendered
+func (s *Stabber) ResponseID() string {
+	return s.responseID
+}
+
+// Method return request method
+func (s *Stabber) Method() string {
+	if s.request == nil {
+		return ""
+	}
+
+	return s.request.Method
+}
+
+// Path return request path
+func (s *Stabber) Path() string {
+	if s.request == nil {
+		return ""
+	}
+
+	return s.request.URL.Path
+}
+
+// Cookie return cookie value from request
+func (s *Stabber) Cookie(name string) string {
+	if s.request == nil {
+		return ""
+	}
+
+	cookie, err := s.request.Cookie(name)
+
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+// Body return raw request body
+func (s *Stabber) Body() string {
+	return string(s.body)
+}
+
+// Form return value from url-encoded form in request body
+func (s *Stabber) Form(name string) string {
+	if !s.parsed["form"] {
+		s.form, _ = url.ParseQuery(string(s.body))
+		s.markParsed("form")
+	}
+
+	return strings.Join(s.form[name], " ")
+}
+
+// Multipart return value of multipart form field from request body
+// (for file fields name of file is returned)
+func (s *Stabber) Multipart(name string) string {
+	if !s.parsed["multipart"] {
+		s.multipart = s.parseMultipart()
+		s.markParsed("multipart")
+	}
+
+	return strings.Join(s.multipart[name], " ")
+}
+
+// JSON return value of field from JSON request body by path (user.roles.0)
+func (s *Stabber) JSON(path string) string {
+	if !s.parsed["json"] {
+		json.Unmarshal(s.body, &s.json)
+		s.markParsed("json")
+	}
+
+	value, _ := rules.GetJSONValue(s.json, path)
+
+	return value
+}
+
+// XML return value from XML request body by XPath expression
+func (s *Stabber) XML(xpath string) string {
+	if !s.parsed["xml"] {
+		s.xml, _ = xmlutil.Parse(s.body)
+		s.markParsed("xml")
+	}
+
+	if s.xml == nil {
+		return ""
+	}
+
+	value, _ := s.xml.QueryOne(xpath)
+
+	return value
+}
+
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 // Brand generates brand name
 func (s *Stabber) Brand(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Brand()
 }
 
 // Character generates random character in the given language
 func (s *Stabber) Character(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Character()
 }
 
 // Characters generates from 1 to 5 characters in the given language
 func (s *Stabber) Characters(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Characters()
 }
 
 // CharactersN generates n random characters in the given language
 func (s *Stabber) CharactersN(lang string, n int) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.CharactersN(n)
 }
 
 // City generates random city
 func (s *Stabber) City(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.City()
 }
 
 // Color generates color name
 func (s *Stabber) Color(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Color()
 }
 
 // Company generates company name
 func (s *Stabber) Company(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Company()
 }
 
 // Continent generates random continent
 func (s *Stabber) Continent(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Continent()
 }
 
 // Country generates random country
 func (s *Stabber) Country(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Country()
 }
 
 // CreditCardNum generated credit card number according to the card number rules
 func (s *Stabber) CreditCardNum(vendor string) string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.CreditCardNum(vendor)
 }
 
 // CreditCardType returns one of the following credit values:
 // VISA, MasterCard, American Express and Discover
 func (s *Stabber) CreditCardType() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.CreditCardType()
 }
 
 // Currency generates currency name
 func (s *Stabber) Currency(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Currency()
 }
 
 // CurrencyCode generates currency code
 func (s *Stabber) CurrencyCode() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.CurrencyCode()
 }
 
 // Day generates day of the month
 func (s *Stabber) Day() int {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.Day()
 }
 
 // Digits returns from 1 to 5 digits as a string
 func (s *Stabber) Digits(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Digits()
 }
 
 // DigitsN returns n digits as a string
 func (s *Stabber) DigitsN(lang string, n int) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.DigitsN(n)
 }
 
 // DomainName generates random domain name
 func (s *Stabber) DomainName() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.DomainName()
 }
 
 // DomainZone generates random domain zone
 func (s *Stabber) DomainZone() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.DomainZone()
 }
 
 // EmailAddress generates email address
 func (s *Stabber) EmailAddress() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.EmailAddress()
 }
 
 // EmailBody generates random email body
 func (s *Stabber) EmailBody(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.EmailBody()
 }
 
 // EmailSubject generates random email subject
 func (s *Stabber) EmailSubject(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.EmailSubject()
 }
 
 // FemaleFirstName generates female first name
 func (s *Stabber) FemaleFirstName(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.FemaleFirstName()
 }
 
 // FemaleFullName generates female full name it can occasionally
 // include prefix or suffix
 func (s *Stabber) FemaleFullName(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.FemaleFullName()
 }
 
 // FemaleFullNameWithPrefix generates prefixed female full name
 // if prefixes for the given language are available
 func (s *Stabber) FemaleFullNameWithPrefix(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.FemaleFullNameWithPrefix()
 }
 
 // FemaleFullNameWithSuffix generates suffixed female full name
 // if suffixes for the given language are available
 func (s *Stabber) FemaleFullNameWithSuffix(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.FemaleFullNameWithSuffix()
 }
 
 // FemaleLastName generates female last name
 func (s *Stabber) FemaleLastName(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.FemaleLastName()
 }
 
 // FemalePatronymic generates female patronymic
 func (s *Stabber) FemalePatronymic(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.FemalePatronymic()
 }
 
 // FirstName generates first name
 func (s *Stabber) FirstName(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.FirstName()
 }
 
 // FullName generates full name it can occasionally include prefix
 // or suffix
 func (s *Stabber) FullName(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.FullName()
 }
 
 // FullNameWithPrefix generates prefixed full name if prefixes for
 // the given language are available
 func (s *Stabber) FullNameWithPrefix(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.FullNameWithPrefix()
 }
 
 // FullNameWithSuffix generates suffixed full name if suffixes for
 // the given language are available
 func (s *Stabber) FullNameWithSuffix(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.FullNameWithSuffix()
 }
 
 // Gender generates random gender
 func (s *Stabber) Gender(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Gender()
 }
 
 // GenderAbbrev returns first downcased letter of the random gender
 func (s *Stabber) GenderAbbrev(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.GenderAbbrev()
 }
 
 // HexColor generates hex color name
 func (s *Stabber) HexColor() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.HexColor()
 }
 
 // HexColorShort generates short hex color name
 func (s *Stabber) HexColorShort() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.HexColorShort()
 }
 
 // IPv4 generates IPv4 address
 func (s *Stabber) IPv4() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.IPv4()
 }
 
 // Industry generates industry name
 func (s *Stabber) Industry(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Industry()
 }
 
 // JobTitle generates job title
 func (s *Stabber) JobTitle(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.JobTitle()
 }
 
 // Language generates random human language
 func (s *Stabber) Language(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Language()
 }
 
 // LastName generates last name
 func (s *Stabber) LastName(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.LastName()
 }
 
 // LatitudeDegress generates latitude degrees (from -180 to 180)
 func (s *Stabber) LatitudeDegress() int {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.LatitudeDegress()
 }
 
 // LatitudeDirection generates latitude direction (N(orth) o S(outh))
 func (s *Stabber) LatitudeDirection(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.LatitudeDirection()
 }
 
 // LatitudeMinutes generates latitude minutes (from 0 to 60)
 func (s *Stabber) LatitudeMinutes() int {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.LatitudeMinutes()
 }
 
 // LatitudeSeconds generates latitude seconds (from 0 to 60)
 func (s *Stabber) LatitudeSeconds() int {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.LatitudeSeconds()
 }
 
 // Latitute generates latitude
 func (s *Stabber) Latitute() float32 {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.Latitute()
 }
 
 // Longitude generates longitude
 func (s *Stabber) Longitude() float32 {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.Longitude()
 }
 
 // LongitudeDegrees generates longitude degrees (from -180 to 180)
 func (s *Stabber) LongitudeDegrees() int {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.LongitudeDegrees()
 }
 
 // LongitudeDirection generates (W(est) or E(ast))
 func (s *Stabber) LongitudeDirection(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.LongitudeDirection()
 }
 
 // LongitudeMinutes generates (from 0 to 60)
 func (s *Stabber) LongitudeMinutes() int {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.LongitudeMinutes()
 }
 
 // LongitudeSeconds generates (from 0 to 60)
 func (s *Stabber) LongitudeSeconds() int {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.LongitudeSeconds()
 }
 
 // MaleFirstName generates male first name
 func (s *Stabber) MaleFirstName(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.MaleFirstName()
 }
 
 // MaleFullName generates male full name it can occasionally include prefix
 // or suffix
 func (s *Stabber) MaleFullName(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.MaleFullName()
 }
 
 // MaleFullNameWithPrefix generates prefixed male full name if prefixes for
 // the given language are available
 func (s *Stabber) MaleFullNameWithPrefix(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.MaleFullNameWithPrefix()
 }
 
 // MaleFullNameWithSuffix generates suffixed male full name if suffixes for
 // the given language are available
 func (s *Stabber) MaleFullNameWithSuffix(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.MaleFullNameWithSuffix()
 }
 
 // MaleLastName generates male last name
 func (s *Stabber) MaleLastName(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.MaleLastName()
 }
 
 // MalePatronymic generates male patronymic
 func (s *Stabber) MalePatronymic(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.MalePatronymic()
 }
 
 // Model generates model name that consists of letters and digits, optionally
 // with a hyphen between them
 func (s *Stabber) Model(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Model()
 }
 
 // Month generates month name
 func (s *Stabber) Month(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Month()
 }
 
 // MonthNum generates month number (from 1 to 12)
 func (s *Stabber) MonthNum() int {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.MonthNum()
 }
 
 // MonthShort generates abbreviated month name
 func (s *Stabber) MonthShort(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.MonthShort()
 }
 
 // Paragraph generates paragraph
 func (s *Stabber) Paragraph(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Paragraph()
 }
 
 // Paragraphs generates from 1 to 5 paragraphs
 func (s *Stabber) Paragraphs(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Paragraphs()
 }
 
 // ParagraphsN generates n paragraphs
 func (s *Stabber) ParagraphsN(lang string, n int) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.ParagraphsN(n)
 }
 
 // Password generates password with the length from atLeast to atMOst charachers,
 // allow* parameters specify whether corresponding symbols can be used
 func (s *Stabber) Password(atLeast, atMost int, allowUpper, allowNumeric, allowSpecial bool) string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.Password(atLeast, atMost, allowUpper, allowNumeric, allowSpecial)
 }
 
 // Patronymic generates patronymic
 func (s *Stabber) Patronymic(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Patronymic()
 }
 
 // Phone generates random phone number using one of the formats format
 // specified in phone_format file
 func (s *Stabber) Phone(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Phone()
 }
 
 // Product generates product title as brand + product name
 func (s *Stabber) Product(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Product()
 }
 
 // ProductName generates product name
 func (s *Stabber) ProductName(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.ProductName()
 }
 
 // Sentence generates random sentence
 func (s *Stabber) Sentence(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Sentence()
 }
 
 // Sentences generates from 1 to 5 random sentences
 func (s *Stabber) Sentences(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Sentences()
 }
 
 // SentencesN generates n random sentences
 func (s *Stabber) SentencesN(lang string, n int) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.SentencesN(n)
 }
 
 // SimplePassword is a wrapper around Password, it generates password with the length
 // from 6 to 12 symbols, with upper characters and numeric symbols allowed
 func (s *Stabber) SimplePassword() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.SimplePassword()
 }
 
 // State generates random state
 func (s *Stabber) State(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.State()
 }
 
 // StateAbbrev generates random state abbreviation
 func (s *Stabber) StateAbbrev(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.StateAbbrev()
 }
 
 // Street generates random street name
 func (s *Stabber) Street(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Street()
 }
 
 // StreetAddress generates random street name along with building number
 func (s *Stabber) StreetAddress(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.StreetAddress()
 }
 
 // Title generates from 2 to 5 titleized words
 func (s *Stabber) Title(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Title()
 }
 
 // TopLevelDomain generates random top level domain
 func (s *Stabber) TopLevelDomain() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.TopLevelDomain()
 }
 
 // UserName generates user name in one of the following forms first name + last
 // name, letter + last names or concatenation of from 1 to 3 lowercased words
 func (s *Stabber) UserName(lang string) string {
-	fake.SetLang("en")
-
-	username := fake.UserName()
-
-	fake.SetLang(stabberFakeLang)
-
-	return username
+	defer s.useLang(DEFAULT_FAKE_LANG)()
+	return fake.UserName()
 }
 
 // WeekDay generates name ot the week day
 func (s *Stabber) WeekDay(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.WeekDay()
 }
 
 // WeekDayShort generates abbreviated name of the week day
 func (s *Stabber) WeekDayShort(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.WeekDayShort()
 }
 
 // WeekdayNum generates number of the day of the week
 func (s *Stabber) WeekdayNum(lang string) int {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.WeekdayNum()
 }
 
 // Word generates random word
 func (s *Stabber) Word(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Word()
 }
 
 // Words generates from 1 to 5 random words
 func (s *Stabber) Words(lang string) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.Words()
 }
 
 // WordsN generates n random words
 func (s *Stabber) WordsN(lang string, n int) string {
-	setLang(lang)
+	defer s.useLang(lang)()
 	return fake.WordsN(n)
 }
 
 // Year generates year using the given boundaries
 func (s *Stabber) Year(from, to int) int {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.Year(from, to)
 }
 
 // Zip generates random zip code using one of the formats specifies in zip_format file
 func (s *Stabber) Zip() string {
+	defer s.useLang(DEFAULT_FAKE_LANG)()
 	return fake.Zip()
 }
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
-func setLang(lang string) {
-	if lang != "" && lang != stabberFakeLang {
-		fake.SetLang(lang)
+// parseMultipart parse multipart form from request body
+func (s *Stabber) parseMultipart() url.Values {
+	result := url.Values{}
+
+	if s.request == nil {
+		return result
+	}
+
+	mediaType, params, err := mime.ParseMediaType(s.request.Header.Get("Content-Type"))
+
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return result
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(s.body), params["boundary"])
+
+	for {
+		part, err := reader.NextPart()
+
+		if err != nil {
+			break
+		}
+
+		if part.FileName() != "" {
+			result.Add(part.FormName(), part.FileName())
+		} else {
+			data, _ := ioutil.ReadAll(part)
+			result.Add(part.FormName(), string(data))
+		}
+
+		part.Close()
+	}
+
+	return result
+}
+
+// markParsed set parsing marker
+func (s *Stabber) markParsed(name string) {
+	if s.parsed == nil {
+		s.parsed = make(map[string]bool)
+	}
+
+	s.parsed[name] = true
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// setSeed set seed for fake data generation, with seed all fake methods
+// return the same data for the same template
+func (s *Stabber) setSeed(seed int64) {
+	s.seed, s.seeded, s.rand = seed, true, rand.New(rand.NewSource(seed))
+}
+
+// randFuncs return template helpers with random source based on stabber
+// seed (nil if seed is not set)
+func (s *Stabber) randFuncs() template.FuncMap {
+	if !s.seeded {
+		return nil
+	}
+
+	return tmplutil.RandFuncs(rand.NewSource(s.seed))
+}
+
+// useLang lock fake package and set given language, returns function which
+// must be called for releasing lock
+func (s *Stabber) useLang(lang string) func() {
+	if lang == "" {
+		lang = DEFAULT_FAKE_LANG
+	}
+
+	// Calls without seed don't change fake package state if language is
+	// the same, so they can be executed concurrently
+	if !s.seeded {
+		fakeLock.RLock()
+
+		if fakeLang == lang {
+			return fakeLock.RUnlock
+		}
+
+		fakeLock.RUnlock()
+	}
+
+	fakeLock.Lock()
+
+	if fake.SetLang(lang) != nil {
+		fake.SetLang(DEFAULT_FAKE_LANG)
+	}
+
+	fakeLang = lang
+
+	if !s.seeded {
+		return fakeLock.Unlock
+	}
+
+	// Every call use own seed from request random source, so result of
+	// call doesn't depend on calls from other requests
+	fake.Seed(s.rand.Int63())
+
+	return func() {
+		fake.Seed(fakeSeeds.Int63())
+		fakeLock.Unlock()
 	}
 }
@@ -0,0 +1,118 @@
+package server
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+type StabberSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&StabberSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *StabberSuite) TestRequestInfo(c *C) {
+	r, _ := http.NewRequest("PUT", "http://127.0.0.1/users/12?id=12", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "abcd"})
+
+	st := newStabber(r, nil, nil, nil, "")
+
+	c.Assert(st.Method(), Equals, "PUT")
+	c.Assert(st.Path(), Equals, "/users/12")
+	c.Assert(st.Cookie("session"), Equals, "abcd")
+	c.Assert(st.Cookie("unknown"), Equals, "")
+	c.Assert(st.Body(), Equals, "")
+	c.Assert(st.JSON("id"), Equals, "")
+
+	st = newStabber(nil, nil, nil, nil, "")
+
+	c.Assert(st.Method(), Equals, "")
+	c.Assert(st.Path(), Equals, "")
+	c.Assert(st.Cookie("session"), Equals, "")
+	c.Assert(st.Form("id"), Equals, "")
+	c.Assert(st.Multipart("id"), Equals, "")
+	c.Assert(st.XML("/id"), Equals, "")
+}
+
+func (s *StabberSuite) TestBody(c *C) {
+	body := `{"user":{"id":12,"name":"Bob","roles":["admin","dev"],"active":true}}`
+	r, _ := http.NewRequest("POST", "http://127.0.0.1/users", nil)
+
+	st := newStabber(r, []byte(body), nil, nil, "")
+
+	c.Assert(st.Body(), Equals, body)
+	c.Assert(st.JSON("user.id"), Equals, "12")
+	c.Assert(st.JSON("user.name"), Equals, "Bob")
+	c.Assert(st.JSON("user.roles.1"), Equals, "dev")
+	c.Assert(st.JSON("user.roles"), Equals, `["admin","dev"]`)
+	c.Assert(st.JSON("user.active"), Equals, "true")
+	c.Assert(st.JSON("user.email"), Equals, "")
+
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	st = newStabber(r, []byte("name=Bob&role=admin&role=dev"), nil, nil, "")
+
+	c.Assert(st.Form("name"), Equals, "Bob")
+	c.Assert(st.Form("role"), Equals, "admin dev")
+	c.Assert(st.Form("email"), Equals, "")
+
+	st = newStabber(r, []byte(`<user id="12"><name>Bob</name></user>`), nil, nil, "")
+
+	c.Assert(st.XML("/user/name"), Equals, "Bob")
+	c.Assert(st.XML("/user/@id"), Equals, "12")
+	c.Assert(st.XML("//email"), Equals, "")
+}
+
+func (s *StabberSuite) TestMultipart(c *C) {
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+
+	writer.WriteField("name", "Bob")
+	file, _ := writer.CreateFormFile("avatar", "bob.png")
+	file.Write([]byte("PNG"))
+	writer.Close()
+
+	r, _ := http.NewRequest("POST", "http://127.0.0.1/users", nil)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	st := newStabber(r, buf.Bytes(), nil, nil, "")
+
+	c.Assert(st.Multipart("name"), Equals, "Bob")
+	c.Assert(st.Multipart("avatar"), Equals, "bob.png")
+	c.Assert(st.Multipart("email"), Equals, "")
+	c.Assert(st.Form("name"), Equals, "")
+}
+
+func (s *StabberSuite) TestSeed(c *C) {
+	st1 := newStabber(nil, nil, nil, nil, "")
+	st1.setSeed(42)
+
+	st2 := newStabber(nil, nil, nil, nil, "")
+	st2.setSeed(42)
+
+	name1, name2 := st1.FullName("en"), st2.FullName("en")
+
+	c.Assert(name1, Equals, name2)
+	c.Assert(st1.EmailAddress(), Equals, st2.EmailAddress())
+	c.Assert(st1.Zip(), Equals, st2.Zip())
+
+	st1.setSeed(42)
+
+	c.Assert(st1.FullName("en"), Equals, name1)
+	c.Assert(st1.randFuncs(), HasLen, 3)
+	c.Assert(newStabber(nil, nil, nil, nil, "").randFuncs(), IsNil)
+}
@@ -0,0 +1,349 @@
+package tmplutil
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// MAX_SEQ_SIZE is max number of items generated by seq function
+const MAX_SEQ_SIZE = 10000
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// timeFormats contains named time formats supported by now function
+var timeFormats = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"Date":        "2006-01-02",
+	"DateTime":    "2006-01-02 15:04:05",
+}
+
+// rnd is random source used by helpers
+var rnd = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Funcs return map with all template helpers
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"uuid":         UUID,
+		"randInt":      RandInt,
+		"randFloat":    RandFloat,
+		"now":          Now,
+		"base64":       Base64,
+		"base64Decode": Base64Decode,
+		"urlEncode":    url.QueryEscape,
+		"urlDecode":    URLDecode,
+		"md5":          MD5,
+		"sha1":         SHA1,
+		"sha256":       SHA256,
+		"jsonEscape":   JSONEscape,
+		"seq":          Seq,
+		"add":          Add,
+		"sub":          Sub,
+		"upper":        strings.ToUpper,
+		"lower":        strings.ToLower,
+		"title":        strings.Title,
+		"trim":         strings.TrimSpace,
+		"trimPrefix":   strings.TrimPrefix,
+		"trimSuffix":   strings.TrimSuffix,
+		"replace":      Replace,
+		"contains":     strings.Contains,
+		"hasPrefix":    strings.HasPrefix,
+		"hasSuffix":    strings.HasSuffix,
+		"split":        strings.Split,
+		"join":         Join,
+		"repeat":       strings.Repeat,
+		"substr":       Substr,
+		"default":      Default,
+	}
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// RandFuncs return map with random helpers (uuid, randInt and randFloat)
+// which use given random source instead of global one. Source is not
+// locked, so map must be used only by one template execution.
+func RandFuncs(source rand.Source) template.FuncMap {
+	r := rand.New(source)
+
+	return template.FuncMap{
+		"uuid":      func() string { return genUUID(r) },
+		"randInt":   func(min, max int) (int, error) { return genInt(r, min, max) },
+		"randFloat": func(min, max float64) float64 { return genFloat(r, min, max) },
+	}
+}
+
+// UUID generate random UUID (version 4)
+func UUID() string {
+	rnd.Lock()
+	defer rnd.Unlock()
+
+	return genUUID(rnd.Rand)
+}
+
+// RandInt return random int in given range (including boundaries)
+func RandInt(min, max int) (int, error) {
+	rnd.Lock()
+	defer rnd.Unlock()
+
+	return genInt(rnd.Rand, min, max)
+}
+
+// RandFloat return random float in given range
+func RandFloat(min, max float64) float64 {
+	rnd.Lock()
+	defer rnd.Unlock()
+
+	return genFloat(rnd.Rand, min, max)
+}
+
+// Now return current time with given offset (+1h, -30m, +2d) and
+// in given format (name like RFC3339, unix, unixms or Go layout).
+// Arguments are optional and can be passed in any order.
+func Now(args ...string) string {
+	date := time.Now()
+	format := time.RFC3339
+
+	for _, arg := range args {
+		offset, err := parseOffset(arg)
+
+		if err == nil {
+			date = date.Add(offset)
+		} else {
+			format = arg
+		}
+	}
+
+	switch format {
+	case "unix":
+		return strconv.FormatInt(date.Unix(), 10)
+	case "unixms":
+		return strconv.FormatInt(date.UnixNano()/int64(time.Millisecond), 10)
+	}
+
+	layout, ok := timeFormats[format]
+
+	if !ok {
+		layout = format
+	}
+
+	return date.Format(layout)
+}
+
+// Base64 return base64 encoded string
+func Base64(data string) string {
+	return base64.StdEncoding.EncodeToString([]byte(data))
+}
+
+// Base64Decode return decoded base64 string
+func Base64Decode(data string) (string, error) {
+	result, err := base64.StdEncoding.DecodeString(data)
+	return string(result), err
+}
+
+// URLDecode return decoded url-encoded string
+func URLDecode(data string) (string, error) {
+	return url.QueryUnescape(data)
+}
+
+// MD5 return hex encoded MD5 hash of string
+func MD5(data string) string {
+	return hashString(md5.New(), data)
+}
+
+// SHA1 return hex encoded SHA-1 hash of string
+func SHA1(data string) string {
+	return hashString(sha1.New(), data)
+}
+
+// SHA256 return hex encoded SHA-256 hash of string
+func SHA256(data string) string {
+	return hashString(sha256.New(), data)
+}
+
+// JSONEscape return string escaped for using inside JSON string
+func JSONEscape(data string) string {
+	result, _ := json.Marshal(data)
+	return string(result[1 : len(result)-1])
+}
+
+// Seq return slice with numbers from 1 to n (seq n) or from first
+// to second number (seq from to)
+func Seq(args ...int) ([]int, error) {
+	var from, to int
+
+	switch len(args) {
+	case 1:
+		from, to = 1, args[0]
+	case 2:
+		from, to = args[0], args[1]
+	default:
+		return nil, fmt.Errorf("seq requires 1 or 2 arguments, got %d", len(args))
+	}
+
+	var result []int
+
+	if to < from {
+		return result, nil
+	}
+
+	// Difference of numbers can overflow int for wide ranges
+	if to-from < 0 || to-from >= MAX_SEQ_SIZE {
+		return nil, fmt.Errorf("seq can't generate more than %d items", MAX_SEQ_SIZE)
+	}
+
+	for i := 0; i <= to-from; i++ {
+		result = append(result, from+i)
+	}
+
+	return result, nil
+}
+
+// Add return sum of numbers
+func Add(a, b int) int {
+	return a + b
+}
+
+// Sub return difference of numbers
+func Sub(a, b int) int {
+	return a - b
+}
+
+// Replace replace all occurrences of old substring in string
+func Replace(data, old, new string) string {
+	return strings.Replace(data, old, new, -1)
+}
+
+// Join join slice items with separator
+func Join(items []string, sep string) string {
+	return strings.Join(items, sep)
+}
+
+// Substr return part of string (from start index to end index)
+func Substr(data string, start, end int) string {
+	symbols := []rune(data)
+
+	if start < 0 {
+		start = 0
+	}
+
+	if end > len(symbols) || end < 0 {
+		end = len(symbols)
+	}
+
+	if start >= end {
+		return ""
+	}
+
+	return string(symbols[start:end])
+}
+
+// Default return default value if given value is empty
+func Default(def, value string) string {
+	if value == "" {
+		return def
+	}
+
+	return value
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// parseOffset parse time offset (duration with sign and with days support)
+func parseOffset(offset string) (time.Duration, error) {
+	if !strings.HasPrefix(offset, "+") && !strings.HasPrefix(offset, "-") {
+		return 0, fmt.Errorf("offset %s must start with sign", offset)
+	}
+
+	if strings.HasSuffix(offset, "d") {
+		days, err := strconv.Atoi(offset[:len(offset)-1])
+
+		if err != nil {
+			return 0, err
+		}
+
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(offset)
+}
+
+// genUUID generate UUID (version 4) using given random generator
+func genUUID(r *rand.Rand) string {
+	data := make([]byte, 16)
+
+	r.Read(data)
+
+	data[6] = (data[6] & 0x0F) | 0x40
+	data[8] = (data[8] & 0x3F) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", data[0:4], data[4:6], data[6:8], data[8:10], data[10:])
+}
+
+// genInt return int in given range using given random generator
+func genInt(r *rand.Rand, min, max int) (int, error) {
+	if max < min {
+		min, max = max, min
+	}
+
+	// Size of range can overflow int for wide ranges
+	if max-min+1 <= 0 {
+		return 0, fmt.Errorf("range from %d to %d is too wide", min, max)
+	}
+
+	return min + r.Intn(max-min+1), nil
+}
+
+// genFloat return float in given range using given random generator
+func genFloat(r *rand.Rand, min, max float64) float64 {
+	if max < min {
+		min, max = max, min
+	}
+
+	return min + r.Float64()*(max-min)
+}
+
+// hashString return hex encoded hash of string
+func hashString(h hash.Hash, data string) string {
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
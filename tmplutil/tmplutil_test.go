@@ -0,0 +1,172 @@
+package tmplutil
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"testing"
+	"text/template"
+	"time"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TmplUtilSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&TmplUtilSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+const (
+	maxInt = int(^uint(0) >> 1)
+	minInt = -maxInt - 1
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *TmplUtilSuite) TestRandom(c *C) {
+	c.Assert(UUID(), Matches, "[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}")
+	c.Assert(UUID(), Not(Equals), UUID())
+
+	for i := 0; i < 100; i++ {
+		n, err := RandInt(10, 5)
+		c.Assert(err, IsNil)
+		c.Assert(n >= 5 && n <= 10, Equals, true)
+
+		f := RandFloat(1.5, 2.5)
+		c.Assert(f >= 1.5 && f <= 2.5, Equals, true)
+	}
+
+	_, err := RandInt(minInt, maxInt)
+	c.Assert(err, NotNil)
+
+	_, err = RandInt(-1, maxInt)
+	c.Assert(err, NotNil)
+
+	n, err := RandInt(0, maxInt-1)
+	c.Assert(err, IsNil)
+	c.Assert(n >= 0, Equals, true)
+}
+
+func (s *TmplUtilSuite) TestRandFuncs(c *C) {
+	f1, f2 := RandFuncs(rand.NewSource(42)), RandFuncs(rand.NewSource(42))
+
+	uuid1 := f1["uuid"].(func() string)()
+
+	c.Assert(uuid1, Matches, "[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}")
+	c.Assert(uuid1, Equals, f2["uuid"].(func() string)())
+	n1, _ := f1["randInt"].(func(int, int) (int, error))(1, 100)
+	n2, _ := f2["randInt"].(func(int, int) (int, error))(1, 100)
+
+	c.Assert(n1, Equals, n2)
+	c.Assert(f1["randFloat"].(func(float64, float64) float64)(1, 2), Equals, f2["randFloat"].(func(float64, float64) float64)(1, 2))
+}
+
+func (s *TmplUtilSuite) TestNow(c *C) {
+	value := Now()
+	date, err := time.Parse(time.RFC3339, value)
+
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(date) < time.Minute, Equals, true)
+
+	value = Now("unix", "+2d")
+	ts, _ := strconv.ParseInt(value, 10, 64)
+	diff := ts - time.Now().Unix()
+
+	c.Assert(diff > 47*3600 && diff <= 48*3600, Equals, true)
+
+	value = Now("-1h", "Date")
+	c.Assert(value, Equals, time.Now().Add(-time.Hour).Format("2006-01-02"))
+
+	value = Now("+0s", "2006")
+	c.Assert(value, Equals, strconv.Itoa(time.Now().Year()))
+
+	_, err = parseOffset("1h")
+	c.Assert(err, NotNil)
+
+	_, err = parseOffset("+Xd")
+	c.Assert(err, NotNil)
+}
+
+func (s *TmplUtilSuite) TestStrings(c *C) {
+	c.Assert(Base64("test"), Equals, "dGVzdA==")
+	c.Assert(MD5("test"), Equals, "098f6bcd4621d373cade4e832627b4f6")
+	c.Assert(SHA1("test"), Equals, "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3")
+	c.Assert(SHA256("test"), Equals, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
+	c.Assert(JSONEscape("a \"b\"\n"), Equals, `a \"b\"\n`)
+	c.Assert(Substr("тестовый", 0, 4), Equals, "тест")
+	c.Assert(Substr("test", 3, 1), Equals, "")
+	c.Assert(Substr("test", -1, 10), Equals, "test")
+	c.Assert(Default("none", ""), Equals, "none")
+	c.Assert(Default("none", "value"), Equals, "value")
+
+	value, err := Base64Decode("dGVzdA==")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "test")
+
+	_, err = Base64Decode("@@@")
+	c.Assert(err, NotNil)
+
+	value, err = URLDecode("a+b%26c")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "a b&c")
+}
+
+func (s *TmplUtilSuite) TestSeq(c *C) {
+	items, err := Seq(3)
+
+	c.Assert(err, IsNil)
+	c.Assert(items, DeepEquals, []int{1, 2, 3})
+
+	items, err = Seq(5, 6)
+
+	c.Assert(err, IsNil)
+	c.Assert(items, DeepEquals, []int{5, 6})
+
+	_, err = Seq()
+	c.Assert(err, NotNil)
+
+	_, err = Seq(0, MAX_SEQ_SIZE*2)
+	c.Assert(err, NotNil)
+
+	_, err = Seq(minInt, maxInt)
+	c.Assert(err, NotNil)
+
+	items, err = Seq(maxInt, minInt)
+
+	c.Assert(err, IsNil)
+	c.Assert(items, HasLen, 0)
+
+	items, err = Seq(maxInt-1, maxInt)
+
+	c.Assert(err, IsNil)
+	c.Assert(items, DeepEquals, []int{maxInt - 1, maxInt})
+}
+
+func (s *TmplUtilSuite) TestTemplate(c *C) {
+	templ, err := template.New("").Funcs(Funcs()).Parse(
+		`{{ range $i := seq 3 }}{{ if gt $i 1 }},{{ end }}{{ $i }}{{ end }}|` +
+			`{{ upper "test" }}|{{ "a b" | urlEncode }}|{{ sub 10 (add 1 2) }}|` +
+			`{{ join (split "a,b" ",") "-" }}|{{ replace "aaa" "a" "b" }}`,
+	)
+
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+
+	c.Assert(templ.Execute(&buf, nil), IsNil)
+	c.Assert(buf.String(), Equals, "1,2,3|TEST|a+b|7|a-b|bbb")
+}
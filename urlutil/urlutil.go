@@ -8,23 +8,243 @@ package urlutil
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 import (
+	"errors"
 	"net/url"
+	"regexp"
+	"regexp/syntax"
 	"sort"
 	"strings"
 )
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
+// maxSamples is max number of samples generated for regexp pattern
+const maxSamples = 32
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// wildcardRegexp is regexp for searching wildcards and named params in pattern
+var wildcardRegexp = regexp.MustCompile(`\{[^}]*\}|\*`)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
 // Match return true if url match given pattern
 func Match(pattern, url string) bool {
-	if pattern == "" {
+	re, err := Compile(pattern)
+
+	if err != nil {
+		return false
+	}
+
+	return MatchCompiled(re, pattern, url)
+}
+
+// MatchCompiled return true if url match given pattern, re must be compiled
+// regexp for pattern (see Compile)
+func MatchCompiled(re *regexp.Regexp, pattern, url string) bool {
+	switch {
+	case pattern == "":
+		return false
+	case IsRegexp(pattern):
+		return re != nil && re.MatchString(url)
+	case pattern == url:
+		return true
+	case HasParams(pattern):
+		if re == nil {
+			return false
+		}
+
+		_, ok := findURLParams(re, pattern, url)
+
+		return ok
+	}
+
+	return matchWildcard(pattern, url)
+}
+
+// Compile return compiled regexp for regexp pattern or pattern with named
+// params and nil for any other pattern
+func Compile(pattern string) (*regexp.Regexp, error) {
+	switch {
+	case IsRegexp(pattern):
+		return compileRegexp(pattern)
+	case HasParams(pattern):
+		return compileParamsRegexp(pattern)
+	}
+
+	return nil, nil
+}
+
+// IsRegexp return true if pattern is regular expression (i.e. ~^/users/\d+$)
+func IsRegexp(pattern string) bool {
+	return strings.HasPrefix(pattern, "~")
+}
+
+// HasParams return true if pattern contains named params (i.e. /users/{id})
+func HasParams(pattern string) bool {
+	if IsRegexp(pattern) {
 		return false
 	}
 
-	if pattern == url {
+	return strings.Contains(pattern, "{") && strings.Contains(pattern, "}")
+}
+
+// ValidateParams check pattern with named params for problems
+func ValidateParams(pattern string) error {
+	_, err := compileParamsRegexp(pattern)
+	return err
+}
+
+// ValidateRegexp check regexp pattern for problems
+func ValidateRegexp(pattern string) error {
+	_, err := compileRegexp(pattern)
+	return err
+}
+
+// ExtractParams return values of named params (or named capture groups
+// for regexp patterns) from url
+func ExtractParams(pattern, url string) map[string]string {
+	re, err := Compile(pattern)
+
+	if err != nil {
+		return nil
+	}
+
+	return ExtractCompiledParams(re, pattern, url)
+}
+
+// ExtractCompiledParams return values of named params (or named capture
+// groups for regexp patterns) from url, re must be compiled regexp for
+// pattern (see Compile)
+func ExtractCompiledParams(re *regexp.Regexp, pattern, url string) map[string]string {
+	if re == nil {
+		return nil
+	}
+
+	var params map[string]string
+
+	switch {
+	case IsRegexp(pattern):
+		params, _ = findParams(re, url)
+	case HasParams(pattern):
+		params, _ = findURLParams(re, pattern, url)
+	}
+
+	return params
+}
+
+// LiteralPrefix return part of pattern before first wildcard or named param
+func LiteralPrefix(pattern string) string {
+	if IsRegexp(pattern) {
+		re, err := compileRegexp(pattern)
+
+		if err != nil {
+			return ""
+		}
+
+		prefix, _ := re.LiteralPrefix()
+
+		return prefix
+	}
+
+	index := wildcardRegexp.FindStringIndex(pattern)
+
+	if index == nil {
+		return pattern
+	}
+
+	return pattern[:index[0]]
+}
+
+// WildcardsNum return number of wildcards and named params in pattern
+func WildcardsNum(pattern string) int {
+	if IsRegexp(pattern) {
+		return 1
+	}
+
+	return len(wildcardRegexp.FindAllString(pattern, -1))
+}
+
+// EqualPatterns compare two patterns
+func EqualPatterns(pattern1, pattern2 string) bool {
+	if IsRegexp(pattern1) || IsRegexp(pattern2) {
+		return equalRegexpPatterns(pattern1, pattern2)
+	}
+
+	if Match(pattern1, pattern2) || Match(pattern2, pattern1) {
 		return true
 	}
 
+	return false
+}
+
+// Sample return url which match given pattern
+func Sample(pattern string) string {
+	samples := getSamples(pattern)
+
+	if len(samples) == 0 {
+		return "/"
+	}
+
+	return samples[0]
+}
+
+// SortURLParams return url with sorted get parameters
+func SortURLParams(u *url.URL) string {
+	query := u.Query()
+
+	if len(query) == 0 {
+		return u.RequestURI()
+	}
+
+	result := u.Path + "?"
+
+	var sortedQuery []string
+
+	for qp := range query {
+		sortedQuery = append(sortedQuery, qp)
+	}
+
+	sort.Strings(sortedQuery)
+
+	for _, qp := range sortedQuery {
+		value := strings.Join(query[qp], "")
+
+		if value == "" {
+			result += qp + "&"
+		} else {
+			result += qp + "=" + value + "&"
+		}
+	}
+
+	result = result[0 : len(result)-1]
+
+	if u.Fragment != "" {
+		result += "#" + u.Fragment
+	}
+
+	return result
+}
+
+// SortParams return url with sorted get parameters
+func SortParams(path string) string {
+	if !strings.Contains(path, "?") {
+		return path
+	}
+
+	u, err := url.Parse(path)
+
+	if err != nil {
+		return path
+	}
+
+	return SortURLParams(u)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// matchWildcard return true if url match given pattern with wildcards
+func matchWildcard(pattern, url string) bool {
 	var (
 		patternIndex  = 0
 		urlIndex      = 0
@@ -42,6 +262,11 @@ func Match(pattern, url string) bool {
 
 	for ; urlIndex < urlLength; urlIndex++ {
 
+		// Pattern is over, but url still has symbols
+		if patternIndex >= patternLength {
+			return false
+		}
+
 		patternSymbol = pattern[patternIndex : patternIndex+1]
 		urlSymbol = url[urlIndex : urlIndex+1]
 
@@ -58,7 +283,7 @@ func Match(pattern, url string) bool {
 
 			if queryPart && !ignoreQuery {
 				if patternIndex+1 < patternLength {
-					if pattern[patternIndex+1:patternIndex+2] == url[urlIndex+1:urlIndex+2] || urlSymbol == "&" {
+					if pattern[patternIndex+1:patternIndex+2] == symbolAt(url, urlIndex+1) || urlSymbol == "&" {
 						patternIndex += 1
 					}
 				} else {
@@ -71,7 +296,7 @@ func Match(pattern, url string) bool {
 					return true
 				}
 
-				if pattern[patternIndex+1:patternIndex+2] == url[urlIndex+1:urlIndex+2] {
+				if pattern[patternIndex+1:patternIndex+2] == symbolAt(url, urlIndex+1) {
 					patternIndex += 1
 				}
 			}
@@ -91,63 +316,219 @@ func Match(pattern, url string) bool {
 	return patternIndex+1 == patternLength
 }
 
-// EqualPatterns compare two patterns
-func EqualPatterns(pattern1, pattern2 string) bool {
-	if Match(pattern1, pattern2) || Match(pattern2, pattern1) {
+// findURLParams match url with compiled regexp for pattern with named params
+// and return map with params values
+func findURLParams(re *regexp.Regexp, pattern, url string) (map[string]string, bool) {
+	target := url
+
+	// Query in pattern is matched by wildcard matcher, so named
+	// params are supported only in path
+	if strings.Contains(pattern, "?") {
+		patternQuery := pattern[strings.Index(pattern, "?"):]
+
+		if !strings.Contains(url, "?") {
+			return nil, false
+		}
+
+		target = url[:strings.Index(url, "?")]
+
+		if !matchWildcard(patternQuery, url[strings.Index(url, "?"):]) {
+			return nil, false
+		}
+	} else if strings.Contains(url, "?") {
+		// Pattern without query matches url with any query
+		target = url[:strings.Index(url, "?")]
+	}
+
+	return findParams(re, target)
+}
+
+// findParams match string with regexp and return map with named groups
+func findParams(re *regexp.Regexp, data string) (map[string]string, bool) {
+	values := re.FindStringSubmatch(data)
+
+	if values == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+
+	for index, name := range re.SubexpNames() {
+		if name != "" {
+			params[name] = values[index]
+		}
+	}
+
+	return params, true
+}
+
+// equalRegexpPatterns return true if patterns (one or both of them is regexp)
+// can match same url
+//
+// Exact check of regular expressions intersection is pretty complex, so we
+// generate samples of urls for every pattern and check them with another one
+func equalRegexpPatterns(pattern1, pattern2 string) bool {
+	if pattern1 == pattern2 {
 		return true
 	}
 
+	for _, sample := range getSamples(pattern1) {
+		if Match(pattern2, sample) {
+			return true
+		}
+	}
+
+	for _, sample := range getSamples(pattern2) {
+		if Match(pattern1, sample) {
+			return true
+		}
+	}
+
 	return false
 }
 
-// SortURLParams return url with sorted get parameters
-func SortURLParams(u *url.URL) string {
-	query := u.Query()
+// getSamples return slice with urls which match given pattern
+func getSamples(pattern string) []string {
+	if !IsRegexp(pattern) {
+		return []string{wildcardRegexp.ReplaceAllString(pattern, "1")}
+	}
 
-	if len(query) == 0 {
-		return u.RequestURI()
+	re, err := syntax.Parse(pattern[1:], syntax.Perl)
+
+	if err != nil {
+		return nil
 	}
 
-	result := u.Path + "?"
+	return genSamples(re.Simplify())
+}
 
-	var sortedQuery []string
+// genSamples generate samples for regexp syntax tree
+func genSamples(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
 
-	for qp := range query {
-		sortedQuery = append(sortedQuery, qp)
-	}
+	case syntax.OpCharClass:
+		var result []string
 
-	sort.Strings(sortedQuery)
+		for i := 0; i < len(re.Rune) && len(result) < maxSamples; i += 2 {
+			result = append(result, string(re.Rune[i]))
+		}
 
-	for _, qp := range sortedQuery {
-		value := strings.Join(query[qp], "")
+		return result
 
-		if value == "" {
-			result += qp + "&"
-		} else {
-			result += qp + "=" + value + "&"
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return []string{"1"}
+
+	case syntax.OpCapture:
+		return genSamples(re.Sub[0])
+
+	case syntax.OpStar, syntax.OpQuest:
+		return append([]string{""}, genSamples(re.Sub[0])...)
+
+	case syntax.OpPlus:
+		return genSamples(re.Sub[0])
+
+	case syntax.OpRepeat:
+		var result = []string{""}
+
+		for i := 0; i < re.Min; i++ {
+			result = joinSamples(result, genSamples(re.Sub[0]))
+		}
+
+		return result
+
+	case syntax.OpConcat:
+		var result = []string{""}
+
+		for _, sub := range re.Sub {
+			result = joinSamples(result, genSamples(sub))
+		}
+
+		return result
+
+	case syntax.OpAlternate:
+		var result []string
+
+		for _, sub := range re.Sub {
+			result = append(result, genSamples(sub)...)
+		}
+
+		if len(result) > maxSamples {
+			result = result[:maxSamples]
 		}
+
+		return result
 	}
 
-	result = result[0 : len(result)-1]
+	// Anchors and empty matches
+	return []string{""}
+}
 
-	if u.Fragment != "" {
-		result += "#" + u.Fragment
+// joinSamples return all combinations of two samples slices
+func joinSamples(prefixes, suffixes []string) []string {
+	var result []string
+
+	for _, prefix := range prefixes {
+		for _, suffix := range suffixes {
+			if len(result) == maxSamples {
+				return result
+			}
+
+			result = append(result, prefix+suffix)
+		}
 	}
 
 	return result
 }
 
-// SortParams return url with sorted get parameters
-func SortParams(path string) string {
-	if !strings.Contains(path, "?") {
-		return path
+// symbolAt return symbol with given index or empty string if index
+// is out of range
+func symbolAt(data string, index int) string {
+	if index >= len(data) {
+		return ""
 	}
 
-	u, err := url.Parse(path)
+	return data[index : index+1]
+}
 
-	if err != nil {
-		return path
+// compileRegexp compile regexp pattern
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(strings.TrimPrefix(pattern, "~"))
+}
+
+// compileParamsRegexp convert pattern with named params to regexp
+func compileParamsRegexp(pattern string) (*regexp.Regexp, error) {
+	var (
+		expr   = "^"
+		path   = pattern
+		isOpen = false
+		name   = ""
+	)
+
+	if strings.Contains(path, "?") {
+		path = path[:strings.Index(path, "?")]
 	}
 
-	return SortURLParams(u)
+	for _, r := range path {
+		switch {
+		case r == '{' && !isOpen:
+			isOpen, name = true, ""
+		case r == '}' && isOpen:
+			isOpen = false
+			expr += "(?P<" + name + ">[^/?&]+)"
+		case isOpen:
+			name += string(r)
+		case r == '*':
+			expr += ".*"
+		default:
+			expr += regexp.QuoteMeta(string(r))
+		}
+	}
+
+	if isOpen {
+		return nil, errors.New("Named param is not closed")
+	}
+
+	return regexp.Compile(expr + "$")
 }
@@ -39,15 +39,132 @@ func (s *URLUtilSuite) TestMatch(c *C) {
 	c.Assert(Match("/testa", "/testb"), Equals, false)
 	c.Assert(Match("/user?action=*", "/user?action=edit&rnd"), Equals, false)
 	c.Assert(Match("/user?action=*", "/user?action=edit&rnd=123"), Equals, false)
+	c.Assert(Match("/a*b", "/axxx"), Equals, false)
+	c.Assert(Match("/a*b", "/axxb"), Equals, true)
+	c.Assert(Match("/a?", "/a?b"), Equals, false)
+}
+
+func (s *URLUtilSuite) TestMatchCompiled(c *C) {
+	re, err := Compile("/users/*")
+
+	c.Assert(err, IsNil)
+	c.Assert(re, IsNil)
+	c.Assert(MatchCompiled(re, "/users/*", "/users/1"), Equals, true)
+
+	re, err = Compile("/users/{id}")
+
+	c.Assert(err, IsNil)
+	c.Assert(MatchCompiled(re, "/users/{id}", "/users/1?x=1"), Equals, true)
+	c.Assert(MatchCompiled(re, "/users/{id}", "/users/1/orders"), Equals, false)
+	c.Assert(MatchCompiled(nil, "/users/{id}", "/users/1"), Equals, false)
+	c.Assert(ExtractCompiledParams(re, "/users/{id}", "/users/1"), DeepEquals, map[string]string{"id": "1"})
+
+	re, err = Compile("~^/orders/(?P<id>\\d+)$")
+
+	c.Assert(err, IsNil)
+	c.Assert(MatchCompiled(re, "~^/orders/(?P<id>\\d+)$", "/orders/12"), Equals, true)
+	c.Assert(MatchCompiled(nil, "~^/orders/(?P<id>\\d+)$", "/orders/12"), Equals, false)
+	c.Assert(ExtractCompiledParams(re, "~^/orders/(?P<id>\\d+)$", "/orders/12"), DeepEquals, map[string]string{"id": "12"})
+	c.Assert(ExtractCompiledParams(nil, "/users/{id}", "/users/1"), IsNil)
+
+	_, err = Compile("~^/orders/[")
+
+	c.Assert(err, NotNil)
+
+	_, err = Compile("/users/{user-id}")
+
+	c.Assert(err, NotNil)
+}
+
+func (s *URLUtilSuite) TestParams(c *C) {
+	c.Assert(HasParams("/users/{id}"), Equals, true)
+	c.Assert(HasParams("/users/*"), Equals, false)
+
+	c.Assert(Match("/users/{id}", "/users/123"), Equals, true)
+	c.Assert(Match("/users/{id}/orders/{orderId}", "/users/1/orders/abc"), Equals, true)
+	c.Assert(Match("/users/{id}/*", "/users/1/orders/abc?limit=10"), Equals, true)
+	c.Assert(Match("/users/{id}?action=*", "/users/1?action=edit"), Equals, true)
+	c.Assert(Match("/users/{id}", "/users/123?action=edit"), Equals, true)
+	c.Assert(Match("/users/{id}/orders/{orderId}", "/users/5/orders/7?x=1"), Equals, true)
+
+	c.Assert(Match("/users/{id}", "/users/123/orders"), Equals, false)
+	c.Assert(Match("/users/{id}", "/users/123/orders?action=edit"), Equals, false)
+	c.Assert(Match("/users/{id}", "/users/"), Equals, false)
+	c.Assert(Match("/users/{id}?action=*", "/users/1"), Equals, false)
+	c.Assert(Match("/users/{id}?action=*", "/users/1?type=1"), Equals, false)
+	c.Assert(Match("/users/{id", "/users/1"), Equals, false)
+
+	c.Assert(ValidateParams("/users/{id}/orders/{orderId}"), IsNil)
+	c.Assert(ValidateParams("/users/{id"), Not(IsNil))
+	c.Assert(ValidateParams("/users/{}"), Not(IsNil))
+	c.Assert(ValidateParams("/users/{user-id}"), Not(IsNil))
+
+	c.Assert(ExtractParams("/users/*", "/users/1"), IsNil)
+	c.Assert(ExtractParams("/users/{id}", "/orders/1"), IsNil)
+	c.Assert(ExtractParams("/users/{id}/orders/{orderId}", "/users/1/orders/abc"), DeepEquals,
+		map[string]string{"id": "1", "orderId": "abc"},
+	)
+	c.Assert(ExtractParams("/users/{id}/orders/{orderId}", "/users/5/orders/7?x=1"), DeepEquals,
+		map[string]string{"id": "5", "orderId": "7"},
+	)
+}
+
+func (s *URLUtilSuite) TestRegexp(c *C) {
+	c.Assert(IsRegexp("~^/users/\\d+$"), Equals, true)
+	c.Assert(IsRegexp("/users/*"), Equals, false)
+	c.Assert(HasParams("~^/users/\\d{2}$"), Equals, false)
+
+	c.Assert(Match("~^/api/v[12]/items/\\d+$", "/api/v1/items/123"), Equals, true)
+	c.Assert(Match("~^/api/(users|items)$", "/api/items"), Equals, true)
+	c.Assert(Match("~^/api/v[12]/items/\\d+$", "/api/v3/items/123"), Equals, false)
+	c.Assert(Match("~^/api/v[12]/items/\\d+$", "/api/v1/items/abc"), Equals, false)
+	c.Assert(Match("~^/api/v[12/items$", "/api/v1/items"), Equals, false)
+
+	c.Assert(ValidateRegexp("~^/api/v[12]/items/\\d+$"), IsNil)
+	c.Assert(ValidateRegexp("~^/api/v[12/items$"), Not(IsNil))
+
+	c.Assert(ExtractParams("~^/api/v[12]/items/\\d+$", "/api/v1/items/123"), DeepEquals, map[string]string{})
+	c.Assert(ExtractParams("~^/api/v(?P<version>[12])/items/(?P<id>\\d+)$", "/api/v2/items/123"), DeepEquals,
+		map[string]string{"version": "2", "id": "123"},
+	)
+}
+
+func (s *URLUtilSuite) TestSpecificity(c *C) {
+	c.Assert(LiteralPrefix("/users"), Equals, "/users")
+	c.Assert(LiteralPrefix("/users/*/orders"), Equals, "/users/")
+	c.Assert(LiteralPrefix("/users/{id}/orders"), Equals, "/users/")
+	c.Assert(LiteralPrefix("~^/users/\\d+$"), Equals, "/users/")
+	c.Assert(LiteralPrefix("~^/users/[0-9+$"), Equals, "")
+
+	c.Assert(WildcardsNum("/users"), Equals, 0)
+	c.Assert(WildcardsNum("/users/*/orders/{id}"), Equals, 2)
+	c.Assert(WildcardsNum("~^/users/\\d+$"), Equals, 1)
 }
 
 func (s *URLUtilSuite) TestEquals(c *C) {
 	c.Assert(EqualPatterns("/user*", "/users*"), Equals, true)
 	c.Assert(EqualPatterns("/users/andy*", "/users/*"), Equals, true)
 	c.Assert(EqualPatterns("/user?id=*", "/user?id*"), Equals, true)
+	c.Assert(EqualPatterns("/users/{id}", "/users/{uid}"), Equals, true)
+	c.Assert(EqualPatterns("/users/{id}", "/users/*"), Equals, true)
+	c.Assert(EqualPatterns("~^/users/\\d+$", "~^/users/\\d+$"), Equals, true)
+	c.Assert(EqualPatterns("~^/users/\\d+$", "~^/users/[0-9]{1,3}$"), Equals, true)
+	c.Assert(EqualPatterns("~^/api/(users|items)/\\d+$", "/api/items/*"), Equals, true)
+	c.Assert(EqualPatterns("/api/items/{id}", "~^/api/(users|items)/\\d+$"), Equals, true)
+	c.Assert(EqualPatterns("~^/users/\\d+$", "/users/123"), Equals, true)
 
 	c.Assert(EqualPatterns("/users/*", "/user/*"), Equals, false)
 	c.Assert(EqualPatterns("/user?id=*", "/user?id=*&rnd=*"), Equals, false)
+	c.Assert(EqualPatterns("~^/users/\\d+$", "~^/users/[a-z]+$"), Equals, false)
+	c.Assert(EqualPatterns("~^/api/(users|items)/\\d+$", "/api/orders/*"), Equals, false)
+	c.Assert(EqualPatterns("~^/users/[0-9+$", "/users/*"), Equals, false)
+}
+
+func (s *URLUtilSuite) TestSample(c *C) {
+	c.Assert(Sample("/users"), Equals, "/users")
+	c.Assert(Sample("/users/{id}/orders/*"), Equals, "/users/1/orders/1")
+	c.Assert(Sample("~^/users/\\d+$"), Equals, "/users/0")
+	c.Assert(Sample("~^/users/[0-9+$"), Equals, "/")
 }
 
 func (s *URLUtilSuite) TestSort(c *C) {
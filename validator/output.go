@@ -0,0 +1,280 @@
+package validator
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"pkg.re/essentialkaos/ek.v3/fmtc"
+	"pkg.re/essentialkaos/ek.v3/fmtutil"
+	"pkg.re/essentialkaos/ek.v3/rand"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+const (
+	SEVERITY_WARN = "warning"
+	SEVERITY_ERR  = "error"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// jsonProblem is problem info for JSON output
+type jsonProblem struct {
+	Rule     string `json:"rule"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Desc     string `json:"description"`
+}
+
+// junitSuites is root element of JUnit report
+type junitSuites struct {
+	XMLName xml.Name      `xml:"testsuites"`
+	Suites  []*junitSuite `xml:"testsuite"`
+}
+
+// junitSuite is test suite in JUnit report (one suite for all rules)
+type junitSuite struct {
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Cases    []*junitCase `xml:"testcase"`
+}
+
+// junitCase is test case in JUnit report (one case for each rule)
+type junitCase struct {
+	Class    string          `xml:"classname,attr"`
+	Name     string          `xml:"name,attr"`
+	Failures []*junitFailure `xml:"failure"`
+	Output   string          `xml:"system-out,omitempty"`
+}
+
+// junitFailure is failure of test case in JUnit report
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// checkstyleReport is root element of Checkstyle report
+type checkstyleReport struct {
+	XMLName xml.Name          `xml:"checkstyle"`
+	Version string            `xml:"version,attr"`
+	Files   []*checkstyleFile `xml:"file"`
+}
+
+// checkstyleFile is file with problems in Checkstyle report
+type checkstyleFile struct {
+	Name   string             `xml:"name,attr"`
+	Errors []*checkstyleError `xml:"error"`
+}
+
+// checkstyleError is problem in Checkstyle report
+type checkstyleError struct {
+	Line     int    `xml:"line,attr,omitempty"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// renderText print check results as colored text
+func renderText(reports []*Report, maxProblemType uint8) {
+	if len(reports) == 0 {
+		fmtc.Println("\n{y}No mock's were found{!}\n")
+		return
+	}
+
+	for _, report := range reports {
+		if len(report.Problems) == 0 {
+			continue
+		}
+
+		fmtutil.Separator(false, report.Rule)
+		renderProblems(report.Problems)
+	}
+
+	if maxProblemType > PROBLEM_NONE {
+		fmtutil.Separator(false)
+	}
+
+	switch maxProblemType {
+	case PROBLEM_NONE:
+		fmtc.Printf("\n{g}%s{!}\n\n", okMessages[rand.Int(len(okMessages))])
+	case PROBLEM_WARN:
+		fmtc.Printf("{y}%s{!}\n\n", warnMessages[rand.Int(len(warnMessages))])
+	case PROBLEM_ERR:
+		fmtc.Printf("{r}%s{!}\n\n", errorMessages[rand.Int(len(errorMessages))])
+	}
+}
+
+// renderProblems print error and warn messages
+func renderProblems(problems []*Problem) {
+	for _, problem := range problems {
+		switch problem.Type {
+		case PROBLEM_WARN:
+			fmtc.Printf("{y}WARNING →{!} {*}%s{!}\n\n", problem.Info)
+		case PROBLEM_ERR:
+			fmtc.Printf("{r}ERROR →{!} {*}%s{!}\n\n", problem.Info)
+		}
+
+		fmtc.Println(fmtutil.Wrap(problem.Desc, "  ", 86))
+		fmtc.NewLine()
+	}
+}
+
+// renderJSON write all problems as JSON array
+func renderJSON(w io.Writer, reports []*Report) error {
+	var problems = make([]*jsonProblem, 0)
+
+	for _, report := range reports {
+		for _, problem := range report.Problems {
+			problems = append(problems,
+				&jsonProblem{
+					Rule:     report.Rule,
+					File:     problem.File,
+					Line:     problem.Line,
+					Column:   problem.Column,
+					Severity: getSeverity(problem),
+					Message:  problem.Info,
+					Desc:     problem.Desc,
+				},
+			)
+		}
+	}
+
+	data, err := json.MarshalIndent(problems, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+
+	return err
+}
+
+// renderJUnit write check results as JUnit report, every rule is test case
+// and every error is failure of test case
+func renderJUnit(w io.Writer, reports []*Report) error {
+	suite := &junitSuite{Name: "mockka", Tests: len(reports)}
+
+	for _, report := range reports {
+		testCase := &junitCase{
+			Class: strings.Split(report.Rule, "/")[0],
+			Name:  report.Rule,
+		}
+
+		var warnings []string
+
+		for _, problem := range report.Problems {
+			if problem.Type != PROBLEM_ERR {
+				warnings = append(warnings, formatProblem(problem))
+				continue
+			}
+
+			testCase.Failures = append(testCase.Failures,
+				&junitFailure{
+					Message: problem.Info,
+					Type:    SEVERITY_ERR,
+					Text:    formatProblem(problem),
+				},
+			)
+		}
+
+		if len(testCase.Failures) != 0 {
+			suite.Failures++
+		}
+
+		testCase.Output = strings.Join(warnings, "\n")
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	return renderXML(w, &junitSuites{Suites: []*junitSuite{suite}})
+}
+
+// renderCheckstyle write check results as Checkstyle report
+func renderCheckstyle(w io.Writer, reports []*Report) error {
+	var files []*checkstyleFile
+	var fileMap = make(map[string]*checkstyleFile)
+
+	for _, report := range reports {
+		if fileMap[report.File] == nil {
+			fileMap[report.File] = &checkstyleFile{Name: report.File}
+			files = append(files, fileMap[report.File])
+		}
+
+		for _, problem := range report.Problems {
+			file := fileMap[problem.File]
+
+			if file == nil {
+				file = &checkstyleFile{Name: problem.File}
+				fileMap[problem.File] = file
+				files = append(files, file)
+			}
+
+			file.Errors = append(file.Errors,
+				&checkstyleError{
+					Line:     problem.Line,
+					Column:   problem.Column,
+					Severity: getSeverity(problem),
+					Message:  problem.Info + ": " + problem.Desc,
+					Source:   "mockka",
+				},
+			)
+		}
+	}
+
+	return renderXML(w, &checkstyleReport{Version: "4.3", Files: files})
+}
+
+// renderXML write given struct as XML document
+func renderXML(w io.Writer, v interface{}) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+
+	return err
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// getSeverity return problem severity name
+func getSeverity(problem *Problem) string {
+	if problem.Type == PROBLEM_ERR {
+		return SEVERITY_ERR
+	}
+
+	return SEVERITY_WARN
+}
+
+// formatProblem return problem info with position
+func formatProblem(problem *Problem) string {
+	switch {
+	case problem.Line == 0:
+		return fmt.Sprintf("%s: %s", problem.File, problem.Desc)
+	case problem.Column == 0:
+		return fmt.Sprintf("%s:%d: %s", problem.File, problem.Line, problem.Desc)
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %s", problem.File, problem.Line, problem.Column, problem.Desc)
+}
@@ -0,0 +1,103 @@
+package validator
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func Test(t *testing.T) { TestingT(t) }
+
+type OutputSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&OutputSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *OutputSuite) TestJSON(c *C) {
+	var buf bytes.Buffer
+
+	c.Assert(renderJSON(&buf, getTestReports()), IsNil)
+	c.Assert(buf.String(), Equals, readGolden(c, "report.json"))
+
+	buf.Reset()
+
+	c.Assert(renderJSON(&buf, nil), IsNil)
+	c.Assert(buf.String(), Equals, "[]\n")
+}
+
+func (s *OutputSuite) TestJUnit(c *C) {
+	var buf bytes.Buffer
+
+	c.Assert(renderJUnit(&buf, getTestReports()), IsNil)
+	c.Assert(buf.String(), Equals, readGolden(c, "report.junit.xml"))
+}
+
+func (s *OutputSuite) TestCheckstyle(c *C) {
+	var buf bytes.Buffer
+
+	c.Assert(renderCheckstyle(&buf, getTestReports()), IsNil)
+	c.Assert(buf.String(), Equals, readGolden(c, "report.checkstyle.xml"))
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// getTestReports return reports with all kinds of problems positions and
+// messages with special symbols
+func getTestReports() []*Report {
+	return []*Report{
+		{
+			Rule: "service/users",
+			File: "rules/service/users.mock",
+			Problems: []*Problem{
+				{
+					Type:   PROBLEM_ERR,
+					Info:   "Template error",
+					Desc:   `Template in @RESPONSE section is malformed: unexpected "<" in operand & 'quotes'`,
+					File:   "rules/service/users.mock",
+					Line:   8,
+					Column: 11,
+				},
+				{
+					Type: PROBLEM_WARN,
+					Info: "Description is <empty>",
+					Desc: `Description is "important" & useful.`,
+					File: "rules/service/users.mock",
+					Line: 1,
+				},
+				{
+					Type: PROBLEM_ERR,
+					Info: "File with response is not exist",
+					Desc: "File rules/service/users.json defined in @RESPONSE section is not exist.",
+					File: "rules/service/users.json",
+				},
+			},
+		},
+		{
+			Rule: "service/orders",
+			File: "rules/service/orders.mock",
+		},
+	}
+}
+
+// readGolden read file with expected output
+func readGolden(c *C, name string) string {
+	data, err := ioutil.ReadFile("../common/testdata/output/" + name)
+
+	c.Assert(err, IsNil)
+
+	return string(data)
+}
@@ -8,20 +8,20 @@ package validator
 // ////////////////////////////////////////////////////////////////////////////////// //
 
 import (
-	"errors"
+	"fmt"
+	"os"
 	"strings"
 
 	"pkg.re/essentialkaos/ek.v3/fmtc"
-	"pkg.re/essentialkaos/ek.v3/fmtutil"
 	"pkg.re/essentialkaos/ek.v3/fsutil"
 	"pkg.re/essentialkaos/ek.v3/httputil"
 	"pkg.re/essentialkaos/ek.v3/knf"
 	"pkg.re/essentialkaos/ek.v3/mathutil"
 	"pkg.re/essentialkaos/ek.v3/path"
-	"pkg.re/essentialkaos/ek.v3/rand"
 	"pkg.re/essentialkaos/ek.v3/sliceutil"
 
 	"github.com/essentialkaos/mockka/rules"
+	"github.com/essentialkaos/mockka/server"
 )
 
 // ////////////////////////////////////////////////////////////////////////////////// //
@@ -32,6 +32,13 @@ const (
 	PROBLEM_ERR        = 2
 )
 
+const (
+	FORMAT_TEXT       = "text"
+	FORMAT_JSON       = "json"
+	FORMAT_JUNIT      = "junit"
+	FORMAT_CHECKSTYLE = "checkstyle"
+)
+
 const (
 	DATA_RULE_DIR = "data:rule-dir"
 )
@@ -45,15 +52,38 @@ type RuleInfo struct {
 }
 
 type Problem struct {
-	Type uint8  // Problem type (none/warn/error)
-	Info string // Info (short info)
-	Desc string // Description (long info)
+	Type   uint8  // Problem type (none/warn/error)
+	Info   string // Info (short info)
+	Desc   string // Description (long info)
+	File   string // Path to file with problem (empty - mock file)
+	Line   int    // Line number (0 - unknown)
+	Column int    // Column number (0 - unknown)
+}
+
+// Report contains check results for one rule
+type Report struct {
+	Rule     string     // Rule name (service/dir/mock)
+	File     string     // Path to mock file
+	Problems []*Problem // Found problems
+}
+
+// ParsedRule contains rule info and parsing result
+type ParsedRule struct {
+	Info  *RuleInfo   // Rule info
+	Rule  *rules.Rule // Parsed rule (nil if rule can't be parsed)
+	Error error       // Parsing error
 }
 
 type Validator func(r *rules.Rule) []*Problem
 
+// CrossValidator is validator which check rule with other rules
+type CrossValidator func(r *rules.Rule, allRules []*rules.Rule) []*Problem
+
 // ////////////////////////////////////////////////////////////////////////////////// //
 
+// formats is slice with supported output formats
+var formats = []string{FORMAT_TEXT, FORMAT_JSON, FORMAT_JUNIT, FORMAT_CHECKSTYLE}
+
 // errorMessages is slice with error messages
 var errorMessages = []string{
 	"Errors... It's so sad :(",
@@ -82,105 +112,187 @@ var okMessages = []string{
 
 // ////////////////////////////////////////////////////////////////////////////////// //
 
-// Check check rule or all rules for some service
-func Check(target string) error {
-	if target == "" {
-		return errors.New("You must difine mock file or service name")
+// Check check rule, all rules of some service or all rules in rule directory
+// (if target is empty), print results in given format (text/json/junit/checkstyle)
+// and return max type of found problems
+func Check(target, format string) (uint8, error) {
+	if format == "" {
+		format = FORMAT_TEXT
 	}
 
-	targetService, targetMock, targetDir := rules.ParsePath(target)
+	if !sliceutil.Contains(formats, format) {
+		return PROBLEM_NONE, fmtc.Errorf("Unknown output format %s", format)
+	}
 
-	serviceDir := path.Join(knf.GetS(DATA_RULE_DIR), targetService)
+	reports, err := checkTarget(knf.GetS(DATA_RULE_DIR), target)
 
-	if !fsutil.IsExist(serviceDir) {
-		return fmtc.Errorf("Service %s is not exist", targetService)
+	if err != nil {
+		return PROBLEM_NONE, err
 	}
 
-	var ruleInfoSlice []*RuleInfo
+	maxProblemType := getMaxProblemType(reports)
 
-	if targetMock != "" {
-		ruleInfoSlice = append(ruleInfoSlice, &RuleInfo{targetService, targetMock, targetDir})
-	} else {
-		mockFiles := fsutil.ListAllFiles(serviceDir, true,
-			&fsutil.ListingFilter{MatchPatterns: []string{"*.mock"}},
-		)
+	switch format {
+	case FORMAT_JSON:
+		return maxProblemType, renderJSON(os.Stdout, reports)
+	case FORMAT_JUNIT:
+		return maxProblemType, renderJUnit(os.Stdout, reports)
+	case FORMAT_CHECKSTYLE:
+		return maxProblemType, renderCheckstyle(os.Stdout, reports)
+	}
 
-		for _, mockFile := range mockFiles {
-			mockPath := path.Join(targetService, strings.Replace(mockFile, ".mock", "", -1))
+	renderText(reports, maxProblemType)
 
-			_, targetMock, targetDir := rules.ParsePath(mockPath)
+	return maxProblemType, nil
+}
 
-			ruleInfoSlice = append(ruleInfoSlice, &RuleInfo{targetService, targetMock, targetDir})
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// checkTarget check rule, all rules of some service or all rules in rule
+// directory (if target is empty) and return reports for all checked rules
+func checkTarget(ruleDir, target string) ([]*Report, error) {
+	allRules := parseRules(ruleDir, findRules(ruleDir, ""))
+
+	var targetRules []*ParsedRule
+
+	if target == "" {
+		targetRules = allRules
+	} else {
+		targetService, targetMock, targetDir := rules.ParsePath(target)
+
+		if !fsutil.IsExist(path.Join(ruleDir, targetService)) {
+			return nil, fmtc.Errorf("Service %s is not exist", targetService)
+		}
+
+		if targetMock != "" {
+			targetRules = parseRules(ruleDir, []*RuleInfo{&RuleInfo{targetService, targetMock, targetDir}})
+		} else {
+			targetRules = parseRules(ruleDir, findRules(ruleDir, targetService))
 		}
 	}
 
-	if len(ruleInfoSlice) == 0 {
-		fmtc.Println("\n{y}No mock's were found{!}\n")
-		return nil
+	var validRules []*rules.Rule
+
+	for _, parsedRule := range allRules {
+		if parsedRule.Rule != nil && parsedRule.Info.Service != "" {
+			validRules = append(validRules, parsedRule.Rule)
+		}
 	}
 
-	var maxProblemType = PROBLEM_NONE
+	var reports []*Report
 
-	for _, rule := range ruleInfoSlice {
-		maxProblemType = mathutil.MaxU8(checkRule(rule), maxProblemType)
+	for _, parsedRule := range targetRules {
+		reports = append(reports, checkRule(ruleDir, parsedRule, validRules))
 	}
 
-	if maxProblemType > PROBLEM_NONE {
-		fmtutil.Separator(false)
+	return reports, nil
+}
+
+// findRules return info about all mock files of service or all mock files
+// in rule directory if service is empty
+func findRules(ruleDir, service string) []*RuleInfo {
+	var result []*RuleInfo
+
+	mockFiles := fsutil.ListAllFiles(path.Join(ruleDir, service), true,
+		&fsutil.ListingFilter{MatchPatterns: []string{"*.mock"}},
+	)
+
+	for _, mockFile := range mockFiles {
+		mockPath := path.Join(service, strings.Replace(mockFile, ".mock", "", -1))
+
+		mockService, mockName, mockDir := rules.ParsePath(mockPath)
+
+		// Mock file placed outside of service directory
+		if mockName == "" {
+			mockService, mockName = "", mockService
+		}
+
+		result = append(result, &RuleInfo{mockService, mockName, mockDir})
 	}
 
-	switch maxProblemType {
-	case PROBLEM_NONE:
-		fmtc.Printf("\n{g}%s{!}\n\n", okMessages[rand.Int(len(okMessages))])
-	case PROBLEM_WARN:
-		fmtc.Printf("{y}%s{!}\n\n", warnMessages[rand.Int(len(warnMessages))])
-	case PROBLEM_ERR:
-		fmtc.Printf("{r}%s{!}\n\n", errorMessages[rand.Int(len(errorMessages))])
+	return result
+}
+
+// parseRules parse all given rules
+func parseRules(ruleDir string, ruleInfoSlice []*RuleInfo) []*ParsedRule {
+	var result []*ParsedRule
+
+	for _, ruleInfo := range ruleInfoSlice {
+		rule, err := rules.Parse(ruleDir, ruleInfo.Service, ruleInfo.Dir, ruleInfo.Name)
+		result = append(result, &ParsedRule{ruleInfo, rule, err})
 	}
 
-	return nil
+	return result
 }
 
-// ////////////////////////////////////////////////////////////////////////////////// //
+// checkRule run validators for parsed rule
+func checkRule(ruleDir string, parsedRule *ParsedRule, allRules []*rules.Rule) *Report {
+	ruleInfo := parsedRule.Info
 
-// checkRule parse rule, run validators and print check results
-func checkRule(ruleInfo *RuleInfo) uint8 {
-	var problems []*Problem
+	report := &Report{
+		Rule: path.Join(ruleInfo.Service, ruleInfo.Dir, ruleInfo.Name),
+		File: path.Join(ruleDir, ruleInfo.Service, ruleInfo.Dir, ruleInfo.Name+".mock"),
+	}
 
-	rule, err := rules.Parse(knf.GetS(DATA_RULE_DIR), ruleInfo.Service, ruleInfo.Dir, ruleInfo.Name)
+	switch {
+	case parsedRule.Error != nil:
+		problem := &Problem{
+			Type: PROBLEM_ERR,
+			Info: "Parsing error",
+			Desc: parsedRule.Error.Error(),
+		}
 
-	if err != nil {
-		problems = append(problems,
+		if parseErr, ok := parsedRule.Error.(*rules.ParseError); ok {
+			problem.Line, problem.Column = parseErr.Line, parseErr.Column
+		}
+
+		report.Problems = append(report.Problems, problem)
+
+	case ruleInfo.Service == "":
+		report.Problems = append(report.Problems,
 			&Problem{
 				Type: PROBLEM_ERR,
-				Info: "Parsing error",
-				Desc: err.Error(),
+				Info: "Mock file outside of service directory",
+				Desc: "Mock file must be placed inside service directory (e.g. rules/my-service/rule.mock). Mock files placed in the root of rule directory are ignored.",
 			},
 		)
-	} else {
 
+	default:
 		validators := []Validator{
+			checkSections,
 			checkDescription,
 			checkWildcard,
 			checkMethod,
 			checkStatusCode,
 			checkContent,
+			checkTemplates,
 		}
 
-		problems = append(problems, execValidators(validators, rule)...)
+		crossValidators := []CrossValidator{
+			checkConflicts,
+		}
+
+		report.Problems = append(report.Problems, execValidators(validators, parsedRule.Rule)...)
+		report.Problems = append(report.Problems, execCrossValidators(crossValidators, parsedRule.Rule, allRules)...)
 	}
 
-	if len(problems) == 0 {
-		return PROBLEM_NONE
+	for _, problem := range report.Problems {
+		if problem.File == "" {
+			problem.File = report.File
+		}
 	}
 
-	fmtutil.Separator(false, path.Join(ruleInfo.Service, ruleInfo.Dir, ruleInfo.Name))
-	renderProblems(problems)
+	return report
+}
 
+// getMaxProblemType return max type of problems in reports
+func getMaxProblemType(reports []*Report) uint8 {
 	var maxProblemType = PROBLEM_NONE
 
-	for _, problem := range problems {
-		maxProblemType = mathutil.MaxU8(problem.Type, maxProblemType)
+	for _, report := range reports {
+		for _, problem := range report.Problems {
+			maxProblemType = mathutil.MaxU8(problem.Type, maxProblemType)
+		}
 	}
 
 	return maxProblemType
@@ -197,19 +309,15 @@ func execValidators(validators []Validator, rule *rules.Rule) []*Problem {
 	return result
 }
 
-// renderProblems print error and warn messages
-func renderProblems(problems []*Problem) {
-	for _, problem := range problems {
-		switch problem.Type {
-		case PROBLEM_WARN:
-			fmtc.Printf("{y}WARNING →{!} {*}%s{!}\n\n", problem.Info)
-		case PROBLEM_ERR:
-			fmtc.Printf("{r}ERROR →{!} {*}%s{!}\n\n", problem.Info)
-		}
+// execCrossValidators run all cross-rule validators
+func execCrossValidators(validators []CrossValidator, rule *rules.Rule, allRules []*rules.Rule) []*Problem {
+	var result []*Problem
 
-		fmtc.Println(fmtutil.Wrap(problem.Desc, "  ", 86))
-		fmtc.NewLine()
+	for _, validator := range validators {
+		result = append(result, validator(rule, allRules)...)
 	}
+
+	return result
 }
 
 // ////////////////////////////////////////////////////////////////////////////////// //
@@ -224,6 +332,7 @@ func checkDescription(r *rules.Rule) []*Problem {
 				Type: PROBLEM_WARN,
 				Info: "Description is empty",
 				Desc: "Description is important part of rule. Please provide short (30-140 chars) info about what this rule do.",
+				Line: r.SectionLine("DESCRIPTION", rules.DEFAULT),
 			},
 		)
 	} else {
@@ -233,6 +342,7 @@ func checkDescription(r *rules.Rule) []*Problem {
 					Type: PROBLEM_WARN,
 					Info: "Description is too short",
 					Desc: "Description is important part of rule. Please provide short (30-140 chars) info about what this rule do.",
+					Line: r.SectionLine("DESCRIPTION", rules.DEFAULT),
 				},
 			)
 		}
@@ -243,6 +353,7 @@ func checkDescription(r *rules.Rule) []*Problem {
 					Type: PROBLEM_WARN,
 					Info: "Description is too long",
 					Desc: "Description is important part of rule. Please provide short (30-140 chars) info about what this rule do.",
+					Line: r.SectionLine("DESCRIPTION", rules.DEFAULT),
 				},
 			)
 		}
@@ -261,6 +372,7 @@ func checkWildcard(r *rules.Rule) []*Problem {
 				Type: PROBLEM_ERR,
 				Info: "Global wildcard",
 				Desc: "You define global wildcard. It's means what this rule handle ALL request. Avoid to use global wildcard and try define more detailed URL.",
+				Line: r.SectionLine("REQUEST", rules.DEFAULT),
 			},
 		)
 	}
@@ -278,6 +390,7 @@ func checkMethod(r *rules.Rule) []*Problem {
 				Type: PROBLEM_ERR,
 				Info: "Unknown HTTP method",
 				Desc: fmtc.Sprintf("You define unsupported HTTP method \"%s\". Valid methods is OPTIONS, GET, HEAD, POST, PUT, DELETE, TRACE, CONNECT and PATCH.", r.Request.Method),
+				Line: r.SectionLine("REQUEST", rules.DEFAULT),
 			},
 		)
 	}
@@ -303,6 +416,7 @@ func checkStatusCode(r *rules.Rule) []*Problem {
 						Type: PROBLEM_WARN,
 						Info: "Unknown status code",
 						Desc: fmtc.Sprintf("You define unknown status code %d in %s section. Please check list of valid status codes https://en.wikipedia.org/wiki/List_of_HTTP_status_codes", resp.Code, sectionId),
+						Line: r.SectionLine("CODE", respId),
 					},
 				)
 			}
@@ -329,6 +443,7 @@ func checkResponseDelay(r *rules.Rule) []*Problem {
 					Type: PROBLEM_WARN,
 					Info: "Response delay is too big",
 					Desc: fmtc.Sprintf("Response delay is greater than maximum delay (60 seconds).", sectionId),
+					Line: r.SectionLine("DELAY", respId),
 				},
 			)
 		}
@@ -355,6 +470,7 @@ func checkContent(r *rules.Rule) []*Problem {
 					Type: PROBLEM_ERR,
 					Info: "Response body have two sources",
 					Desc: fmtc.Sprintf("You define two different sources for response body (file and content in response section) in section %s. Please use only one source (file OR content in response section).", sectionId),
+					Line: r.SectionLine("RESPONSE", respId),
 				},
 			)
 		}
@@ -365,6 +481,7 @@ func checkContent(r *rules.Rule) []*Problem {
 					Type: PROBLEM_ERR,
 					Info: "Response body have two sources",
 					Desc: fmtc.Sprintf("You define two different sources for response body (url and content in response section) in section %s. Please use only one source (url OR content in response section).", sectionId),
+					Line: r.SectionLine("RESPONSE", respId),
 				},
 			)
 		}
@@ -376,6 +493,7 @@ func checkContent(r *rules.Rule) []*Problem {
 						Type: PROBLEM_ERR,
 						Info: "Response body is empty",
 						Desc: fmtc.Sprintf("Section %s doesn't contains any response data.", sectionId),
+						Line: r.SectionLine("RESPONSE", respId),
 					},
 				)
 			}
@@ -387,6 +505,7 @@ func checkContent(r *rules.Rule) []*Problem {
 					Type: PROBLEM_ERR,
 					Info: "File with response is not exist",
 					Desc: fmtc.Sprintf("File %s defined in %s section is not exist.", resp.File, sectionId),
+					Line: r.SectionLine("RESPONSE", respId),
 				},
 			)
 		} else {
@@ -396,6 +515,7 @@ func checkContent(r *rules.Rule) []*Problem {
 						Type: PROBLEM_ERR,
 						Info: "File with response is not readable",
 						Desc: fmtc.Sprintf("File %s defined in %s section is not readable.", resp.File, sectionId),
+						Line: r.SectionLine("RESPONSE", respId),
 					},
 				)
 			}
@@ -404,3 +524,135 @@ func checkContent(r *rules.Rule) []*Problem {
 
 	return result
 }
+
+// checkTemplates check responses templates for problems
+func checkTemplates(r *rules.Rule) []*Problem {
+	var result []*Problem
+
+	for respId, resp := range r.Responses {
+		if resp.URL != "" {
+			continue
+		}
+
+		if resp.File != "" && !fsutil.IsReadable(resp.File) {
+			continue
+		}
+
+		sectionId := "@RESPONSE"
+
+		if respId != rules.DEFAULT {
+			sectionId += ":" + respId
+		}
+
+		err := server.CheckTemplate(resp)
+
+		if err != nil {
+			problem := getTemplateProblem(r, respId, resp, err)
+			problem.Type = PROBLEM_ERR
+			problem.Info = "Template error"
+			problem.Desc = fmt.Sprintf("Template in %s section is malformed: %v", sectionId, err)
+
+			if resp.File != "" {
+				problem.Desc = fmt.Sprintf("Template in file %s defined in %s section is malformed: %v", resp.File, sectionId, err)
+			}
+
+			result = append(result, problem)
+
+			continue
+		}
+
+		// Rendering errors can be caused by synthetic request data, so
+		// they are reported as warnings
+		err = server.DryRunTemplate(r, respId, resp)
+
+		if err == nil {
+			continue
+		}
+
+		problem := getTemplateProblem(r, respId, resp, err)
+		problem.Type = PROBLEM_WARN
+		problem.Info = "Template rendering problem"
+		problem.Desc = fmt.Sprintf("Template in %s section can't be rendered for sample request: %v", sectionId, err)
+
+		if resp.File != "" {
+			problem.Desc = fmt.Sprintf("Template in file %s defined in %s section can't be rendered for sample request: %v", resp.File, sectionId, err)
+		}
+
+		result = append(result, problem)
+	}
+
+	return result
+}
+
+// getTemplateProblem create problem with position of template error
+func getTemplateProblem(r *rules.Rule, respId string, resp *rules.Response, err error) *Problem {
+	problem := &Problem{File: resp.File}
+
+	if posErr, ok := err.(*rules.PositionError); ok {
+		problem.Line, problem.Column = posErr.Line, posErr.Column
+	} else if resp.File == "" {
+		problem.Line = r.SectionLine("RESPONSE", respId)
+	}
+
+	return problem
+}
+
+// checkSections check rule for unknown sections
+func checkSections(r *rules.Rule) []*Problem {
+	var result []*Problem
+
+	for _, warning := range r.Warnings {
+		result = append(result,
+			&Problem{
+				Type:   PROBLEM_WARN,
+				Info:   "Unknown section",
+				Desc:   fmt.Sprintf("Section %s on line %d is unknown and will be ignored with all its content.", warning.Text, warning.Line),
+				Line:   warning.Line,
+				Column: warning.Column,
+			},
+		)
+	}
+
+	return result
+}
+
+// checkConflicts check rule for conflicts with other rules
+func checkConflicts(r *rules.Rule, allRules []*rules.Rule) []*Problem {
+	var result []*Problem
+
+	for _, conflict := range rules.FindConflicts(r, allRules) {
+		switch conflict.Type {
+		case rules.CONFLICT_DUPLICATE:
+			result = append(result,
+				&Problem{
+					Type: PROBLEM_ERR,
+					Info: "Duplicate rule",
+					Desc: fmt.Sprintf("Rule has same host, method, URL and request matchers as rule %s. Only one of these rules will be used.", conflict.Other.PrettyPath),
+					Line: r.SectionLine("REQUEST", rules.DEFAULT),
+				},
+			)
+
+		case rules.CONFLICT_OVERLAP:
+			result = append(result,
+				&Problem{
+					Type: PROBLEM_ERR,
+					Info: "Overlapping wildcards",
+					Desc: fmt.Sprintf("Rule URL matches same URLs as URL of rule %s and both rules have same priority. Use @PRIORITY section or more specific URL for defining order of rules checking.", conflict.Other.PrettyPath),
+					Line: r.SectionLine("REQUEST", rules.DEFAULT),
+				},
+			)
+
+		case rules.CONFLICT_SHADOW:
+			result = append(result,
+				&Problem{
+					Type: PROBLEM_WARN,
+					Info: "Unreachable rule",
+					Desc: fmt.Sprintf("All requests which fit this rule are handled by rule %s which is checked before. Change priority of rules (@PRIORITY section) or make URL of rule %s more specific.", conflict.Other.PrettyPath, conflict.Other.PrettyPath),
+					Line: r.SectionLine("REQUEST", rules.DEFAULT),
+				},
+			)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,96 @@
+package validator
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Rules with conflicts placed in hidden directory, because they can't be
+// loaded by observer in tests which use common test data
+const testRuleDir = "../common/testdata/.validator"
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+type ValidatorSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&ValidatorSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *ValidatorSuite) TestCheckAll(c *C) {
+	reports, err := checkTarget(testRuleDir, "")
+
+	c.Assert(err, IsNil)
+	c.Assert(reports, HasLen, 4)
+	c.Assert(getMaxProblemType(reports), Equals, uint8(PROBLEM_ERR))
+
+	c.Assert(getProblems(reports, "users/list"), DeepEquals, []string{
+		"Overlapping wildcards",
+	})
+
+	c.Assert(getProblems(reports, "accounts/orders"), DeepEquals, []string{
+		"Overlapping wildcards",
+	})
+
+	c.Assert(getProblems(reports, "billing/price"), DeepEquals, []string{
+		"File with response is not exist",
+		"Unreachable rule",
+	})
+
+	c.Assert(getProblems(reports, "stock/items"), HasLen, 0)
+}
+
+func (s *ValidatorSuite) TestCheckService(c *C) {
+	reports, err := checkTarget(testRuleDir, "billing")
+
+	c.Assert(err, IsNil)
+	c.Assert(reports, HasLen, 1)
+	c.Assert(reports[0].File, Equals, testRuleDir+"/billing/price.mock")
+
+	c.Assert(getProblems(reports, "billing/price"), DeepEquals, []string{
+		"File with response is not exist",
+		"Unreachable rule",
+	})
+
+	reports, err = checkTarget(testRuleDir, "users/list")
+
+	c.Assert(err, IsNil)
+	c.Assert(reports, HasLen, 1)
+
+	c.Assert(getProblems(reports, "users/list"), DeepEquals, []string{
+		"Overlapping wildcards",
+	})
+
+	_, err = checkTarget(testRuleDir, "unknown")
+
+	c.Assert(err, NotNil)
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// getProblems return info about all problems found in given rule
+func getProblems(reports []*Report, rule string) []string {
+	var result []string
+
+	for _, report := range reports {
+		if report.Rule != rule {
+			continue
+		}
+
+		for _, problem := range report.Problems {
+			result = append(result, problem.Info)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,411 @@
+package xmlutil
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Node is XML document node
+type Node struct {
+	Name     string            // Element local name (empty for document node)
+	Attrs    map[string]string // Element attributes
+	Children []*Node           // Child elements
+
+	text   string // Element own text
+	parent *Node  // Parent node
+}
+
+// step is one step of XPath expression
+type step struct {
+	Descendant bool   // Step use descendant axis (//)
+	Name       string // Element name, * or @attribute or text()
+	Predicate  string // Raw predicate without brackets
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Parse parse XML document and return document node
+func Parse(data []byte) (*Node, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	document := &Node{}
+	current := document
+
+	for {
+		token, err := decoder.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &Node{
+				Name:   t.Name.Local,
+				Attrs:  make(map[string]string),
+				parent: current,
+			}
+
+			for _, attr := range t.Attr {
+				node.Attrs[attr.Name.Local] = attr.Value
+			}
+
+			current.Children = append(current.Children, node)
+			current = node
+
+		case xml.EndElement:
+			current = current.parent
+
+		case xml.CharData:
+			current.text += string(t)
+		}
+	}
+
+	if len(document.Children) == 0 {
+		return nil, errors.New("document is empty")
+	}
+
+	return document, nil
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// Text return text content of node and all child nodes
+func (n *Node) Text() string {
+	if n == nil {
+		return ""
+	}
+
+	var buf bytes.Buffer
+
+	n.writeText(&buf)
+
+	return strings.TrimSpace(buf.String())
+}
+
+// Query return values of all nodes found by XPath expression. Supported
+// subset: absolute and relative paths, // axis, *, text(), @attr and
+// predicates [n], [@attr], [@attr='value'] and [name='value']
+func (n *Node) Query(expr string) ([]string, error) {
+	steps, err := parseExpr(expr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []*Node{n.document()}
+
+	for i, s := range steps {
+		last := i == len(steps)-1
+
+		switch {
+		case strings.HasPrefix(s.Name, "@"):
+			if !last {
+				return nil, fmt.Errorf("attribute %s must be last step of expression", s.Name)
+			}
+
+			return getAttrs(nodes, s), nil
+
+		case s.Name == "text()":
+			if !last {
+				return nil, errors.New("text() must be last step of expression")
+			}
+
+			return getTexts(nodes, s), nil
+		}
+
+		nodes, err = selectNodes(nodes, s)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result []string
+
+	for _, node := range nodes {
+		result = append(result, node.Text())
+	}
+
+	return result, nil
+}
+
+// QueryOne return value of first node found by XPath expression
+func (n *Node) QueryOne(expr string) (string, error) {
+	values, err := n.Query(expr)
+
+	if err != nil || len(values) == 0 {
+		return "", err
+	}
+
+	return values[0], nil
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// document return document node
+func (n *Node) document() *Node {
+	for n.parent != nil {
+		n = n.parent
+	}
+
+	return n
+}
+
+// writeText write text of node and all child nodes to buffer
+func (n *Node) writeText(buf *bytes.Buffer) {
+	buf.WriteString(n.text)
+
+	for _, child := range n.Children {
+		child.writeText(buf)
+	}
+}
+
+// descendants append all descendant nodes to slice
+func (n *Node) descendants(nodes []*Node) []*Node {
+	for _, child := range n.Children {
+		nodes = append(nodes, child)
+		nodes = child.descendants(nodes)
+	}
+
+	return nodes
+}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+// parseExpr split XPath expression to steps
+func parseExpr(expr string) ([]step, error) {
+	expr = strings.TrimSpace(expr)
+
+	if expr == "" {
+		return nil, errors.New("expression is empty")
+	}
+
+	var steps []step
+
+	for expr != "" {
+		var s step
+
+		switch {
+		case strings.HasPrefix(expr, "//"):
+			s.Descendant = true
+			expr = expr[2:]
+		case strings.HasPrefix(expr, "/"):
+			expr = expr[1:]
+		}
+
+		end := strings.IndexAny(expr, "/[")
+
+		if end == -1 {
+			end = len(expr)
+		}
+
+		s.Name, expr = expr[:end], expr[end:]
+
+		if strings.HasPrefix(expr, "[") {
+			end = findPredicateEnd(expr)
+
+			if end == -1 {
+				return nil, errors.New("predicate is not closed")
+			}
+
+			s.Predicate, expr = strings.TrimSpace(expr[1:end]), expr[end+1:]
+		}
+
+		if s.Name == "" {
+			return nil, errors.New("expression contains empty step")
+		}
+
+		steps = append(steps, s)
+	}
+
+	return steps, nil
+}
+
+// findPredicateEnd return index of closing bracket of predicate
+func findPredicateEnd(expr string) int {
+	var quote rune
+
+	for i, r := range expr {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ']':
+			return i
+		}
+	}
+
+	return -1
+}
+
+// selectNodes return nodes selected by step from given context nodes
+func selectNodes(context []*Node, s step) ([]*Node, error) {
+	var result []*Node
+
+	seen := make(map[*Node]bool)
+
+	for _, node := range context {
+		candidates := node.Children
+
+		if s.Descendant {
+			candidates = node.descendants(nil)
+		}
+
+		var matched []*Node
+
+		for _, candidate := range candidates {
+			if s.Name == "*" || candidate.Name == s.Name {
+				matched = append(matched, candidate)
+			}
+		}
+
+		matched, err := filterNodes(matched, s.Predicate)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matched {
+			if !seen[m] {
+				seen[m] = true
+				result = append(result, m)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// filterNodes return nodes which fit predicate
+func filterNodes(nodes []*Node, predicate string) ([]*Node, error) {
+	if predicate == "" {
+		return nodes, nil
+	}
+
+	index, err := strconv.Atoi(predicate)
+
+	if err == nil {
+		if index < 1 || index > len(nodes) {
+			return nil, nil
+		}
+
+		return nodes[index-1 : index], nil
+	}
+
+	name, value, hasValue, err := parsePredicate(predicate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Node
+
+	for _, node := range nodes {
+		if isNodeFit(node, name, value, hasValue) {
+			result = append(result, node)
+		}
+	}
+
+	return result, nil
+}
+
+// parsePredicate parse predicate in format name='value' or @name='value'
+func parsePredicate(predicate string) (string, string, bool, error) {
+	index := strings.Index(predicate, "=")
+
+	if index == -1 {
+		return predicate, "", false, nil
+	}
+
+	name := strings.TrimSpace(predicate[:index])
+	value := strings.TrimSpace(predicate[index+1:])
+
+	if len(value) < 2 || (value[0] != '\'' && value[0] != '"') || value[len(value)-1] != value[0] {
+		return "", "", false, fmt.Errorf("predicate [%s] is malformed", predicate)
+	}
+
+	return name, value[1 : len(value)-1], true, nil
+}
+
+// isNodeFit return true if node has attribute or child element with given value
+func isNodeFit(node *Node, name, value string, hasValue bool) bool {
+	if strings.HasPrefix(name, "@") {
+		attr, ok := node.Attrs[name[1:]]
+		return ok && (!hasValue || attr == value)
+	}
+
+	for _, child := range node.Children {
+		if child.Name == name && (!hasValue || child.Text() == value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getAttrs return values of attributes from given nodes
+func getAttrs(context []*Node, s step) []string {
+	var result []string
+
+	for _, node := range context {
+		nodes := []*Node{node}
+
+		if s.Descendant {
+			nodes = node.descendants(nodes)
+		}
+
+		for _, n := range nodes {
+			value, ok := n.Attrs[s.Name[1:]]
+
+			if ok {
+				result = append(result, value)
+			}
+		}
+	}
+
+	return result
+}
+
+// getTexts return own text of given nodes
+func getTexts(context []*Node, s step) []string {
+	var result []string
+
+	for _, node := range context {
+		nodes := []*Node{node}
+
+		if s.Descendant {
+			nodes = node.descendants(nodes)
+		}
+
+		for _, n := range nodes {
+			text := strings.TrimSpace(n.text)
+
+			if text != "" {
+				result = append(result, text)
+			}
+		}
+	}
+
+	return result
+}
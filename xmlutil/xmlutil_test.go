@@ -0,0 +1,97 @@
+package xmlutil
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+//                                                                                    //
+//                     Copyright (c) 2009-2016 Essential Kaos                         //
+//      Essential Kaos Open Source License <http://essentialkaos.com/ekol?en>         //
+//                                                                                    //
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+import (
+	"testing"
+
+	. "pkg.re/check.v1"
+)
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+const testDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<order id="42">
+  <user type="admin">
+    <name>Bob</name>
+    <email>bob@domain.com</email>
+  </user>
+  <items>
+    <item sku="A1"><title>Pen</title><count>2</count></item>
+    <item sku="B2"><title>Book</title><count>1</count></item>
+  </items>
+</order>`
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func Test(t *testing.T) { TestingT(t) }
+
+type XMLUtilSuite struct{}
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+var _ = Suite(&XMLUtilSuite{})
+
+// ////////////////////////////////////////////////////////////////////////////////// //
+
+func (s *XMLUtilSuite) TestParsing(c *C) {
+	_, err := Parse([]byte(""))
+	c.Assert(err, NotNil)
+
+	_, err = Parse([]byte("<order><user></order>"))
+	c.Assert(err, NotNil)
+
+	doc, err := Parse([]byte(testDoc))
+
+	c.Assert(err, IsNil)
+	c.Assert(doc.Children, HasLen, 1)
+	c.Assert(doc.Children[0].Name, Equals, "order")
+	c.Assert(doc.Children[0].Attrs["id"], Equals, "42")
+	c.Assert(doc.Children[0].Children[0].Children[1].Text(), Equals, "bob@domain.com")
+}
+
+func (s *XMLUtilSuite) TestQuery(c *C) {
+	doc, err := Parse([]byte(testDoc))
+
+	c.Assert(err, IsNil)
+
+	var checks = map[string]string{
+		"/order/user/name":                  "Bob",
+		"order/user/email":                  "bob@domain.com",
+		"/order/@id":                        "42",
+		"//user/@type":                      "admin",
+		"//item[2]/title":                   "Book",
+		"//item[@sku='A1']/count":           "2",
+		"//item[title=\"Book\"]/@sku":       "B2",
+		"/order/*/item/title/text()":        "Pen",
+		"//name":                            "Bob",
+		"/order/user[@type]/name":           "Bob",
+		"/order/user[@type='guest']/name":   "",
+		"//item[3]/title":                   "",
+		"/order/unknown":                    "",
+		"//items//title":                    "Pen",
+		"/order/items/item[@sku='B2']/*[1]": "Book",
+	}
+
+	for expr, expected := range checks {
+		value, err := doc.QueryOne(expr)
+
+		c.Assert(err, IsNil, Commentf("Expression: %s", expr))
+		c.Assert(value, Equals, expected, Commentf("Expression: %s", expr))
+	}
+
+	values, err := doc.Query("//item/@sku")
+
+	c.Assert(err, IsNil)
+	c.Assert(values, DeepEquals, []string{"A1", "B2"})
+
+	for _, expr := range []string{"", "/order//", "//item[1", "/@id/name", "//item[@sku=A1]"} {
+		_, err = doc.Query(expr)
+		c.Assert(err, NotNil, Commentf("Expression: %s", expr))
+	}
+}